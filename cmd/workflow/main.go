@@ -19,8 +19,8 @@ func main() {
 	db, _ := database.Connect(dbURL, dbURL, false, logging.New("app", os.Stderr))
 	fmt.Println("got db: ", db)
 
-	jobStore := run.NewJobsStore()
 	stepperStore := run.NewStepperStore()
+	jobStore := run.NewJobsStore(stepperStore)
 	setupJob(jobStore, stepperStore)
 
 	//rr := run.NewDatabaseStorage(db)
@@ -0,0 +1,50 @@
+// Package control pauses the execution of every run of a job, of a job and
+// scope, or of every job at once.
+package control
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidControl = errors.New("a control with a scope must have a job name")
+
+// Control pauses the queues of runs it matches. A control without a job name
+// matches every job, and one without a scope matches every scope of its job.
+type Control struct {
+	JobName  string `gorm:"primary_key"`
+	Scope    string `gorm:"primary_key"`
+	Reason   string
+	PausedBy string
+
+	// RejectTriggers rejects the triggers of the matching jobs instead of
+	// queuing their runs until the control is removed.
+	RejectTriggers bool
+
+	Created time.Time
+}
+
+// Validate checks that the control can be matched against runs.
+func (c Control) Validate() error {
+	if c.Scope != "" && c.JobName == "" {
+		return ErrInvalidControl
+	}
+	return nil
+}
+
+// Matches reports whether the control pauses the runs of the job and scope.
+func (c Control) Matches(job, scope string) bool {
+	return (c.JobName == "" || c.JobName == job) && (c.Scope == "" || c.Scope == scope)
+}
+
+// Matching returns the controls that pause the runs of the job and scope.
+func Matching(controls []Control, job, scope string) []Control {
+	var matching []Control
+	for _, c := range controls {
+		if c.Matches(job, scope) {
+			matching = append(matching, c)
+		}
+	}
+	return matching
+}
@@ -0,0 +1,43 @@
+package control_test
+
+import (
+	"testing"
+
+	"github.com/mitchfriedman/workflow/lib/control"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestControl_Matches(t *testing.T) {
+	tests := map[string]struct {
+		control   control.Control
+		job       string
+		scope     string
+		wantMatch bool
+	}{
+		"global":                    {control.Control{}, "deploy", "app", true},
+		"of the job":                {control.Control{JobName: "deploy"}, "deploy", "app", true},
+		"of another job":            {control.Control{JobName: "build"}, "deploy", "app", false},
+		"of the job and scope":      {control.Control{JobName: "deploy", Scope: "app"}, "deploy", "app", true},
+		"of the job, another scope": {control.Control{JobName: "deploy", Scope: "other"}, "deploy", "app", false},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.wantMatch, tc.control.Matches(tc.job, tc.scope))
+		})
+	}
+}
+
+func TestControl_Validate(t *testing.T) {
+	assert.Nil(t, control.Control{}.Validate())
+	assert.Nil(t, control.Control{JobName: "deploy", Scope: "app"}.Validate())
+	assert.Equal(t, control.ErrInvalidControl, control.Control{Scope: "app"}.Validate())
+}
+
+func TestMatching(t *testing.T) {
+	controls := []control.Control{{JobName: "deploy"}, {JobName: "build"}, {}}
+	assert.Equal(t, []control.Control{{JobName: "deploy"}, {}}, control.Matching(controls, "deploy", "app"))
+	assert.Empty(t, control.Matching(controls[:2], "test", "app"))
+}
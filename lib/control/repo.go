@@ -0,0 +1,79 @@
+package control
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	database "github.com/mitchfriedman/workflow/lib/db"
+	"github.com/mitchfriedman/workflow/lib/tracing"
+)
+
+var ErrNotFound = errors.New("record not found")
+
+type Repo interface {
+	// Pause creates the control, or updates the control of the same job and
+	// scope.
+	Pause(context.Context, *Control) error
+	// Resume removes the control of the job and scope.
+	Resume(ctx context.Context, job, scope string) error
+	ListControls(context.Context) ([]Control, error)
+}
+
+type Storage struct {
+	db *database.DB
+}
+
+func NewDatabaseStorage(db *database.DB) *Storage {
+	return &Storage{db: db}
+}
+
+func (r *Storage) Pause(ctx context.Context, c *Control) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	c.Created = time.Now().UTC()
+
+	span, db, ctx := tracing.NewDBSpan(ctx, r.db.Master, "control.pause")
+	err := db.Exec(`
+		INSERT INTO controls (job_name, scope, reason, paused_by, reject_triggers, created) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (job_name, scope) DO UPDATE SET
+			reason = excluded.reason, paused_by = excluded.paused_by, reject_triggers = excluded.reject_triggers`,
+		c.JobName, c.Scope, c.Reason, c.PausedBy, c.RejectTriggers, c.Created).Error
+	span.RecordError(err)
+	span.Finish()
+
+	if err != nil {
+		return errors.Wrapf(err, "failed to pause %s-%s", c.JobName, c.Scope)
+	}
+	return nil
+}
+
+func (r *Storage) Resume(ctx context.Context, job, scope string) error {
+	span, db, ctx := tracing.NewDBSpan(ctx, r.db.Master, "control.resume")
+	res := db.Where("job_name = ? AND scope = ?", job, scope).Delete(&Control{})
+	span.RecordError(res.Error)
+	span.Finish()
+
+	switch {
+	case res.Error != nil:
+		return res.Error
+	case res.RowsAffected == 0:
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *Storage) ListControls(ctx context.Context) ([]Control, error) {
+	var controls []Control
+	span, db, ctx := tracing.NewDBSpan(ctx, r.db.Reader, "control.list_controls")
+	err := db.Find(&controls).Error
+	span.RecordError(err)
+	span.Finish()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query controls")
+	}
+	return controls, nil
+}
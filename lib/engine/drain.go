@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mitchfriedman/workflow/lib/run"
+)
+
+var shutdownTimeout = 10 * time.Second
+
+// Drain stops the engine from claiming new runs. The steps that are executing
+// get the grace period to finish, after which they are cancelled. Start then
+// releases the runs still claimed by the worker, deregisters it and returns.
+// Drain doesn't wait for any of that, and can be called more than once.
+func (e *Engine) Drain() {
+	e.drainOnce.Do(func() {
+		e.logger.Printf("engine: draining worker %s", e.w.UUID)
+		close(e.drain)
+	})
+}
+
+// Draining reports whether Drain has been called.
+func (e *Engine) Draining() bool {
+	select {
+	case <-e.drain:
+		return true
+	default:
+		return false
+	}
+}
+
+// DrainOnSignal drains e when one of sigs, such as syscall.SIGTERM, is
+// received. The returned func stops listening for the signals.
+func DrainOnSignal(e *Engine, sigs ...os.Signal) func() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-c:
+			e.logger.Printf("engine: received %s", sig)
+			e.Drain()
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
+
+// shutdown releases the runs that are still claimed by the worker, which can
+// happen when a release failed, and deregisters the worker so that its runs
+// don't wait on the watchdog.
+func (e *Engine) shutdown(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, shutdownTimeout)
+	defer cancel()
+
+	runs, err := e.rr.ClaimedRuns(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch claimed runs")
+	}
+
+	for _, r := range runs {
+		if r.ClaimedBy == nil || *r.ClaimedBy != e.w.UUID {
+			continue
+		}
+
+		_, err := run.Update(ctx, e.rr, r, func(latest *run.Run) error {
+			if latest.ClaimedBy == nil || *latest.ClaimedBy != e.w.UUID {
+				return errNotClaimed
+			}
+			return nil
+		})
+		if err != nil && err != errNotClaimed {
+			return errors.Wrapf(err, "failed to release run %s", r.UUID)
+		}
+	}
+
+	if err := e.wr.Deregister(ctx, e.w.UUID); err != nil {
+		return errors.Wrapf(err, "failed to deregister worker %s", e.w.UUID)
+	}
+	return nil
+}
+
+// detach returns a context with the values of ctx that is never cancelled.
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
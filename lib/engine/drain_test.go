@@ -0,0 +1,105 @@
+package engine_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mitchfriedman/workflow/lib/engine"
+	"github.com/mitchfriedman/workflow/lib/logging"
+	"github.com/mitchfriedman/workflow/lib/metrics"
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+	"github.com/mitchfriedman/workflow/lib/worker"
+)
+
+// gateStep signals that it started and succeeds once it is released, or
+// errors once its context is done.
+type gateStep struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *gateStep) Type() string               { return "say_hello" }
+func (s *gateStep) RequiredInput() []run.Input { return []run.Input{} }
+
+func (s *gateStep) StepContext(ctx context.Context, d run.InputData) (run.Result, error) {
+	s.started <- struct{}{}
+	select {
+	case <-s.release:
+		return run.Result{State: run.StateSuccess}, nil
+	case <-ctx.Done():
+		return run.Result{}, ctx.Err()
+	}
+}
+
+func TestEngine_Drain(t *testing.T) {
+	tests := map[string]struct {
+		gracePeriod   time.Duration
+		release       bool
+		wantStepState run.State
+	}{
+		"step finishes within the grace period":    {time.Minute, true, run.StateSuccess},
+		"step is cancelled after the grace period": {10 * time.Millisecond, false, run.StateQueued},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			rr := testhelpers.NewMemoryRepo()
+			wr := testhelpers.NewMemoryWorkerRepo()
+			ss := testhelpers.CreateStepperStore()
+			step := &gateStep{started: make(chan struct{}, 1), release: make(chan struct{})}
+			ss.RegisterContext(step)
+
+			w := worker.NewWorker()
+			assert.Nil(t, wr.Register(context.Background(), w))
+
+			logger := logging.New("test", os.Stderr)
+			stats, _ := metrics.LoadStatsd("", "", "", []string{}, logger)
+			e := engine.NewEngine(w, ss, rr, wr, make(chan worker.Heartbeat, 1), logger, stats,
+				engine.WithPollAfter(time.Millisecond),
+				engine.WithGracePeriod(tc.gracePeriod))
+
+			r := testhelpers.CreateSampleRun("job", "s1", make(run.InputData))
+			assert.Nil(t, rr.CreateRun(context.Background(), r))
+
+			done := make(chan error)
+			go func() {
+				done <- e.Start(context.Background())
+			}()
+
+			<-step.started
+			e.Drain()
+			assert.True(t, e.Draining())
+
+			// runs created while draining aren't claimed.
+			other := testhelpers.CreateSampleRun("job", "s2", make(run.InputData))
+			assert.Nil(t, rr.CreateRun(context.Background(), other))
+
+			if tc.release {
+				close(step.release)
+			}
+			assert.Nil(t, <-done)
+
+			found, err := rr.GetRun(context.Background(), r.UUID)
+			assert.Nil(t, err)
+			assert.Equal(t, run.StateQueued, found.State)
+			assert.Equal(t, tc.wantStepState, found.Steps.State)
+			assert.Equal(t, 0, found.Steps.Attempts)
+			assert.Nil(t, found.ClaimedBy)
+
+			found, err = rr.GetRun(context.Background(), other.UUID)
+			assert.Nil(t, err)
+			assert.Nil(t, found.ClaimedBy)
+			assert.Equal(t, run.StateQueued, found.Steps.State)
+
+			registered, err := wr.Get(context.Background(), w.UUID)
+			assert.Nil(t, err)
+			assert.Nil(t, registered)
+		})
+	}
+}
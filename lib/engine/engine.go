@@ -22,18 +22,21 @@ Engine is a processor of steps. It's algorithms is:
 At startup and in the background, begin a heartbeat goroutine to update it's
 TTL every X seconds to indicate it's still doing work.
 
-Then, enter into an infinite loop to perform the following:
+Then, in each of the concurrent slots of the engine, enter into an infinite
+loop to perform the following:
 
 1. Exit if we should stop processing.
 2. Poll for the next step to execute.
-3. Execute the step.
-4. Go back to 1.
+3. Execute the step. If it completed, go back to 1.
+4. Otherwise, or if there was nothing to execute, wait until the listener is
+   notified of new work or the poll interval passes, then go back to 1.
 
 */
 
 var defaultPollAfter = 5 * time.Second
 var defaultLeaseDuration = time.Minute
 var defaultLeaseRenewDuration = 15 * time.Second
+var defaultGracePeriod = 30 * time.Second
 
 type Engine struct {
 	w          *worker.Worker
@@ -47,6 +50,35 @@ type Engine struct {
 	leaseDuration      time.Duration
 	leaseRenewDuration time.Duration
 	pollAfter          time.Duration
+	concurrency        int
+	executorOptions    []ExecutorOption
+	listener           run.Listener
+	slots              []*slot
+	gracePeriod        time.Duration
+
+	drainOnce sync.Once
+	drain     chan struct{}
+}
+
+// slot is one of the executors of an engine. It tracks the run it has
+// claimed, if any.
+type slot struct {
+	id int
+
+	mu  sync.Mutex
+	run string
+}
+
+func (s *slot) claim(uuid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.run = uuid
+}
+
+func (s *slot) claimed() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.run
 }
 
 type Option func(e *Engine)
@@ -69,66 +101,182 @@ func WithPollAfter(d time.Duration) Option {
 	}
 }
 
+// WithConcurrency sets the number of runs the engine executes at the same
+// time. It defaults to 1.
+func WithConcurrency(n int) Option {
+	return func(e *Engine) {
+		e.concurrency = n
+	}
+}
+
+// WithGracePeriod sets how long the steps that are executing when the engine
+// is drained get to finish before they are cancelled.
+func WithGracePeriod(d time.Duration) Option {
+	return func(e *Engine) {
+		e.gracePeriod = d
+	}
+}
+
+// WithListener wakes up the engine as soon as the listener is notified that
+// runs may be ready to execute. Polling every pollAfter remains as a fallback.
+func WithListener(l run.Listener) Option {
+	return func(e *Engine) {
+		e.listener = l
+	}
+}
+
+// WithExecutorOptions sets the options of the Executor used to execute each
+// run, such as WithStepTimeout.
+func WithExecutorOptions(options ...ExecutorOption) Option {
+	return func(e *Engine) {
+		e.executorOptions = append(e.executorOptions, options...)
+	}
+}
+
 func NewEngine(w *worker.Worker, ss *run.StepperStore, rr run.Repo, wr worker.Repo, heartbeats chan worker.Heartbeat, logger logging.StructuredLogger, metrics *statsd.Client, options ...Option) *Engine {
 	e := &Engine{w: w, ss: ss, rr: rr, wr: wr, heartbeats: heartbeats, logger: logger}
 	e.leaseDuration = defaultLeaseDuration
 	e.leaseRenewDuration = defaultLeaseRenewDuration
 	e.pollAfter = defaultPollAfter
+	e.concurrency = 1
+	e.gracePeriod = defaultGracePeriod
+	e.drain = make(chan struct{})
 	e.logger = logger
 	e.metrics = metrics
 
 	for _, opt := range options {
 		opt(e)
 	}
+
+	if e.concurrency < 1 {
+		e.concurrency = 1
+	}
+	for i := 0; i < e.concurrency; i++ {
+		e.slots = append(e.slots, &slot{id: i})
+	}
 	return e
 }
 
+// Start executes runs until the engine is drained, either by cancelling ctx
+// or by calling Drain. See Drain for how the engine stops.
 func (e *Engine) Start(ctx context.Context) (err error) {
 	span, ctx := tracing.NewServiceSpan(ctx, "engine.start")
 	defer func() {
 		span.RecordError(err)
 		span.Finish()
 	}()
-	go e.heartbeat(ctx)
-
-	var terminate bool
-	var termMu sync.RWMutex
-
-	go func(ctx context.Context) {
-		for {
-			select {
-			case <-ctx.Done():
-				termMu.Lock()
-				terminate = true
-				termMu.Unlock()
-				return
-			default:
-				time.Sleep(10 * time.Millisecond)
+
+	hbCtx, stopHeartbeat := context.WithCancel(detach(ctx))
+	defer stopHeartbeat()
+	go e.heartbeat(hbCtx)
+
+	// the steps aren't cancelled along with ctx, so that they get the grace
+	// period to finish.
+	execCtx, cancelSteps := context.WithCancel(detach(ctx))
+	defer cancelSteps()
+
+	// every slot executes runs on its own, sharing the registration and the
+	// heartbeat of the worker.
+	var wg sync.WaitGroup
+	for _, s := range e.slots {
+		wg.Add(1)
+		go func(s *slot) {
+			defer wg.Done()
+			e.run(execCtx, s)
+		}(s)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-ctx.Done():
+		e.Drain()
+	case <-e.drain:
+	case <-stopped:
+	}
+
+	// the steps that are in flight are cancelled once the grace period is
+	// over, which leaves them queued to be executed by another worker.
+	select {
+	case <-stopped:
+	case <-time.After(e.gracePeriod):
+		e.logger.Printf("engine: cancelling steps still executing after %s", e.gracePeriod)
+		cancelSteps()
+		<-stopped
+	}
+	stopHeartbeat()
+
+	return e.shutdown(detach(ctx))
+}
+
+func (e *Engine) run(ctx context.Context, s *slot) {
+	for !e.Draining() {
+		progressed, err := e.process(ctx, s)
+		switch err {
+		case nil:
+			// a step completed, so there may be more work waiting: look for
+			// it right away. A step that is still queued, such as one that
+			// polls, is left until the next poll instead.
+			if progressed {
+				continue
 			}
+		case ErrNoRuns:
+		default:
+			e.logger.Errorf("slot %d: failed to process steps: %v", s.id, err)
 		}
-	}(ctx)
+		e.wait(ctx)
+	}
+}
 
-	for {
-		termMu.Lock()
-		if terminate {
-			termMu.Unlock()
-			break
+// Claims returns the uuids of the runs that are currently claimed by the
+// slots of the engine.
+func (e *Engine) Claims() []string {
+	var claims []string
+	for _, s := range e.slots {
+		if uuid := s.claimed(); uuid != "" {
+			claims = append(claims, uuid)
 		}
-		termMu.Unlock()
-		err := e.process(ctx)
-		if err != nil {
-			e.logger.Errorf("failed to process steps: %v", err)
+	}
+	return claims
+}
+
+// wait blocks until runs may be ready to execute: the listener was notified
+// or pollAfter has passed. Once the notifications of the listener are closed,
+// the engine falls back to polling.
+func (e *Engine) wait(ctx context.Context) {
+	var notifications <-chan struct{}
+	if e.listener != nil {
+		notifications = e.listener.Notifications()
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-e.drain:
+	case _, ok := <-notifications:
+		if !ok {
+			e.poll(ctx)
 		}
-		time.Sleep(e.pollAfter)
+	case <-time.After(e.pollAfter):
 	}
+}
 
-	return nil
+func (e *Engine) poll(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-e.drain:
+	case <-time.After(e.pollAfter):
+	}
 }
 
 func executionStatus(err error) string {
 	switch {
 	case err == ErrNoRuns:
 		return "no_runs"
+	case err == ErrRunCanceled:
+		return "canceled"
 	case err != nil:
 		return "failed"
 	default:
@@ -136,15 +284,22 @@ func executionStatus(err error) string {
 	}
 }
 
-func (e *Engine) process(ctx context.Context) (err error) {
+// process executes the next run, if any, and returns whether a step of it
+// completed.
+func (e *Engine) process(ctx context.Context, s *slot) (progressed bool, err error) {
 	span, ctx := tracing.NewServiceSpan(ctx, "engine.process")
 	defer func() {
-		span.RecordError(err)
+		if err != ErrNoRuns {
+			span.RecordError(err)
+		}
 		span.Finish()
 	}()
 
-	// TODO: set context timeout.
-	ex := NewExecutor(e.w.UUID, e.rr, e.ss)
+	// the steps are given ctx, so they are cancelled when the engine stops. The
+	// executor adds the deadline of each step.
+	options := append([]ExecutorOption{WithMetrics(e.metrics)}, e.executorOptions...)
+	ex := NewExecutor(e.w.UUID, e.rr, e.ss, options...)
+	ex.onClaim = s.claim
 	err = ex.Execute(ctx)
 
 	e.metrics.Count("workflow.engine.execute", 1, []string{
@@ -152,10 +307,11 @@ func (e *Engine) process(ctx context.Context) (err error) {
 	}, 1.0)
 
 	switch err {
-	case ErrNoRuns:
-		return nil
+	case ErrRunCanceled:
+		// the run was changed underneath the executor, so look at it again.
+		return true, nil
 	default:
-		return err
+		return ex.progressed, err
 	}
 }
 
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -167,3 +168,192 @@ func ensureStepsStatus(t *testing.T, step *run.Step, finalStepName string, final
 		ensureStepsStatus(t, step.OnFailure, finalStepName, finalState)
 	}
 }
+
+type chanListener chan struct{}
+
+func (l chanListener) Notifications() <-chan struct{} {
+	return l
+}
+
+func TestEngine_Listener(t *testing.T) {
+	rr := testhelpers.NewMemoryRepo()
+	ss := testhelpers.CreateStepperStore()
+	listener := make(chanListener, 1)
+
+	logger := logging.New("test", os.Stderr)
+	stats, _ := metrics.LoadStatsd("", "", "", []string{}, logger)
+	hbs := make(chan worker.Heartbeat, 1)
+
+	// the engine only polls once an hour, so it can only find the run
+	// through the notification.
+	e := engine.NewEngine(worker.NewWorker(), ss, rr, testhelpers.NewMemoryWorkerRepo(), hbs, logger, stats,
+		engine.WithPollAfter(time.Hour),
+		engine.WithListener(listener))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- e.Start(ctx)
+	}()
+
+	r := testhelpers.CreateSampleRun("job", "s1", make(run.InputData))
+	assert.Nil(t, rr.CreateRun(context.Background(), r))
+	listener <- struct{}{}
+
+	// every step of the run is executed without waiting in between.
+	for ctx.Err() == nil {
+		found, err := rr.GetRun(context.Background(), r.UUID)
+		assert.Nil(t, err)
+		if found.Terminal() {
+			assert.Equal(t, run.StateSuccess, found.State)
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(t, ctx.Err())
+
+	cancel()
+	assert.Nil(t, <-done)
+}
+
+// countingRepo counts the attempts to claim a run.
+type countingRepo struct {
+	*testhelpers.MemoryRepo
+	claims int32
+}
+
+func (r *countingRepo) ClaimNextRun(ctx context.Context, workerID string, d time.Duration, prioritize run.Prioritizer) (*run.Run, error) {
+	atomic.AddInt32(&r.claims, 1)
+	return r.MemoryRepo.ClaimNextRun(ctx, workerID, d, prioritize)
+}
+
+// pollingStep stays queued, like a step that polls an external system.
+type pollingStep struct {
+	calls int32
+}
+
+func (s *pollingStep) Type() string               { return "say_hello" }
+func (s *pollingStep) RequiredInput() []run.Input { return []run.Input{} }
+
+func (s *pollingStep) Step(d run.InputData) (run.Result, error) {
+	atomic.AddInt32(&s.calls, 1)
+	return run.Result{State: run.StateQueued}, nil
+}
+
+func TestEngine_Waits(t *testing.T) {
+	tests := map[string]struct {
+		listener chanListener
+		withRun  bool
+	}{
+		"for a step that is still queued":                   {nil, true},
+		"once the notifications of the listener are closed": {make(chanListener), false},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			rr := &countingRepo{MemoryRepo: testhelpers.NewMemoryRepo()}
+			ss := run.NewStepperStore()
+			step := &pollingStep{}
+			ss.Register(step)
+			if tc.withRun {
+				setupRun(t, rr)
+			}
+
+			logger := logging.New("test", os.Stderr)
+			stats, _ := metrics.LoadStatsd("", "", "", []string{}, logger)
+			options := []engine.Option{engine.WithPollAfter(time.Hour)}
+			if tc.listener != nil {
+				close(tc.listener)
+				options = append(options, engine.WithListener(tc.listener))
+			}
+			e := engine.NewEngine(worker.NewWorker(), ss, rr, testhelpers.NewMemoryWorkerRepo(), make(chan worker.Heartbeat, 1), logger, stats, options...)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			assert.Nil(t, e.Start(ctx))
+
+			// the engine waits for the next poll instead of claiming again.
+			assert.Equal(t, int32(1), atomic.LoadInt32(&rr.claims))
+			if tc.withRun {
+				assert.Equal(t, int32(1), atomic.LoadInt32(&step.calls))
+			}
+		})
+	}
+}
+
+// barrierStep succeeds once n steps are executing at the same time, and
+// errors if that doesn't happen before its context is done.
+type barrierStep struct {
+	mu      sync.Mutex
+	n       int
+	release chan struct{}
+}
+
+func (s *barrierStep) Type() string               { return "say_hello" }
+func (s *barrierStep) RequiredInput() []run.Input { return []run.Input{} }
+
+func (s *barrierStep) StepContext(ctx context.Context, d run.InputData) (run.Result, error) {
+	s.mu.Lock()
+	s.n--
+	if s.n == 0 {
+		close(s.release)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.release:
+		return run.Result{State: run.StateSuccess}, nil
+	case <-ctx.Done():
+		return run.Result{}, ctx.Err()
+	}
+}
+
+func TestEngine_Concurrency(t *testing.T) {
+	rr := testhelpers.NewMemoryRepo()
+	ss := testhelpers.CreateStepperStore()
+	ss.RegisterContext(&barrierStep{n: 3, release: make(chan struct{})})
+
+	logger := logging.New("test", os.Stderr)
+	stats, _ := metrics.LoadStatsd("", "", "", []string{}, logger)
+	hbs := make(chan worker.Heartbeat, 1)
+
+	var runs []*run.Run
+	for _, scope := range []string{"s1", "s2", "s3"} {
+		r := testhelpers.CreateSampleRun("job", scope, make(run.InputData))
+		assert.Nil(t, rr.CreateRun(context.Background(), r))
+		runs = append(runs, r)
+	}
+
+	e := engine.NewEngine(worker.NewWorker(), ss, rr, testhelpers.NewMemoryWorkerRepo(), hbs, logger, stats,
+		engine.WithPollAfter(time.Millisecond),
+		engine.WithConcurrency(3),
+		engine.WithExecutorOptions(engine.WithStepTimeout(5*time.Second)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- e.Start(ctx)
+	}()
+
+	// the first step of every run only succeeds if the runs are executed
+	// concurrently.
+	for _, r := range runs {
+		for ctx.Err() == nil {
+			found, err := rr.GetRun(context.Background(), r.UUID)
+			assert.Nil(t, err)
+			if found.Terminal() {
+				assert.Equal(t, run.StateSuccess, found.State)
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	assert.Nil(t, ctx.Err())
+
+	cancel()
+	assert.Nil(t, <-done)
+	assert.Empty(t, e.Claims())
+}
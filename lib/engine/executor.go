@@ -2,8 +2,14 @@ package engine
 
 import (
 	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
 	"time"
 
+	"github.com/DataDog/datadog-go/statsd"
+
+	"github.com/mitchfriedman/workflow/lib/control"
 	"github.com/mitchfriedman/workflow/lib/tracing"
 
 	"github.com/mitchfriedman/workflow/lib/run"
@@ -11,23 +17,100 @@ import (
 )
 
 var claimDuration = 30 * time.Second
+var defaultCancelPollInterval = 5 * time.Second
 
 var ErrNoRuns = errors.New("no runs to execute")
 
+// ErrRunCanceled is returned by Execute when the run was cancelled, or timed
+// out by the watchdog, while its steps were executing.
+var ErrRunCanceled = errors.New("run was canceled while executing")
+
 type Executor struct {
 	workerID     string
 	runRepo      run.Repo
 	stepperStore *run.StepperStore
+
+	stepTimeout        time.Duration
+	cancelPollInterval time.Duration
+	panicPolicy        PanicPolicy
+	metrics            *statsd.Client
+	controls           control.Repo
+
+	// onClaim is told the uuid of the run the executor claims, and an empty
+	// uuid once it's released.
+	onClaim func(uuid string)
+
+	// progressed is set by Execute when a step of the run completed, so more
+	// work may be ready right away.
+	progressed bool
+}
+
+type ExecutorOption func(p *Executor)
+
+// PanicPolicy decides what happens to a step whose Stepper panicked.
+type PanicPolicy int
+
+const (
+	// PanicError moves the step into the error state, which stops the run
+	// without rolling back. It is the default.
+	PanicError PanicPolicy = iota
+	// PanicFail fails the step, so that its OnFailure step is executed.
+	PanicFail
+)
+
+// WithPanicPolicy sets what happens to a step whose Stepper panicked.
+func WithPanicPolicy(policy PanicPolicy) ExecutorOption {
+	return func(p *Executor) {
+		p.panicPolicy = policy
+	}
+}
+
+// WithMetrics sets the client that metrics about the executed steps are sent
+// to.
+func WithMetrics(metrics *statsd.Client) ExecutorOption {
+	return func(p *Executor) {
+		p.metrics = metrics
+	}
 }
 
-func NewExecutor(workerID string, runRepo run.Repo, ss *run.StepperStore) *Executor {
-	return &Executor{
-		workerID:     workerID,
-		runRepo:      runRepo,
-		stepperStore: ss,
+// WithStepTimeout sets the timeout of steps that don't declare a Timeout of
+// their own. A zero duration leaves those steps without a timeout.
+func WithStepTimeout(d time.Duration) ExecutorOption {
+	return func(p *Executor) {
+		p.stepTimeout = d
 	}
 }
 
+// WithCancelPollInterval sets how often the run is checked for cancellation
+// while its steps are executing.
+func WithCancelPollInterval(d time.Duration) ExecutorOption {
+	return func(p *Executor) {
+		p.cancelPollInterval = d
+	}
+}
+
+// WithControls sets the repo of the controls that pause the queues of runs.
+// The runs of a paused queue are not claimed.
+func WithControls(cr control.Repo) ExecutorOption {
+	return func(p *Executor) {
+		p.controls = cr
+	}
+}
+
+func NewExecutor(workerID string, runRepo run.Repo, ss *run.StepperStore, options ...ExecutorOption) *Executor {
+	p := &Executor{
+		workerID:           workerID,
+		runRepo:            runRepo,
+		stepperStore:       ss,
+		cancelPollInterval: defaultCancelPollInterval,
+	}
+
+	for _, opt := range options {
+		opt(p)
+	}
+	return p
+}
+
 func (p *Executor) Execute(ctx context.Context) (err error) {
 	span, ctx := tracing.NewServiceSpan(ctx, "executor.execute")
 	defer func() {
@@ -35,53 +118,288 @@ func (p *Executor) Execute(ctx context.Context) (err error) {
 		span.Finish()
 	}()
 
-	r, err := p.nextRun(ctx)
+	prioritize := PrioritizeRuns
+	if p.controls != nil {
+		controls, err := p.controls.ListControls(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch controls")
+		}
+		prioritize = SkipPaused(prioritize, controls)
+	}
+
+	r, err := p.runRepo.ClaimNextRun(ctx, p.workerID, claimDuration, prioritize)
 	if err != nil {
-		return errors.Wrap(err, "failed to fetch next run")
+		return errors.Wrap(err, "failed to claim next run")
 	}
 
 	if r == nil {
 		return ErrNoRuns
 	}
 
+	if p.onClaim != nil {
+		p.onClaim(r.UUID)
+		defer p.onClaim("")
+	}
+
+	queued, err := r.NextSteps()
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch next steps")
+	}
+
+	// the start of each step is saved with the claim, so that the watchdog
+	// can time out a step that runs past its timeout.
+	started := time.Now().UTC()
+	for _, q := range queued {
+		q.Step.Started = &started
+
+		// the time a step spent parked doesn't count against the progress
+		// of the run, so the watchdog doesn't time it out once it wakes up.
+		if q.Step.Parked() {
+			r.LastStepComplete = &started
+			q.Step.Output.WakeAt = nil
+			q.Step.Output.Signal = ""
+		}
+	}
+
 	err = p.runRepo.ClaimRun(ctx, r, p.workerID, claimDuration)
+	if err == run.ErrConflict {
+		// the run was cancelled or otherwise changed right after it was
+		// claimed, so it is left for the next poll.
+		if err := p.releaseLatest(ctx, r); err != nil {
+			return errors.Wrap(err, "failed to release changed run")
+		}
+		return ErrRunCanceled
+	}
 	if err != nil {
 		return errors.Wrap(err, "failed to claim run")
 	}
 
-	s, input, err := r.NextStep()
-	if err != nil {
-		return errors.Wrap(err, "failed to fetch next step")
+	steppers := make([]run.ContextStepper, len(queued))
+	var inputErr error
+	for i, q := range queued {
+		stepper, err := p.getStepper(q.Step)
+		if err != nil {
+			return errors.Wrap(err, "failed to get stepper")
+		}
+
+		// a step without valid input can never succeed, so it is aborted with
+		// the details of every problem in its output.
+		input, err := run.ValidateInput(q.Input, stepper.RequiredInput())
+		if err != nil {
+			inputErr = err
+			p.abortStep(err, r, q.Step, q.Input)
+			continue
+		}
+		queued[i].Input = input
+		steppers[i] = stepper
 	}
 
-	stepper, err := p.getStepper(s)
-	if err != nil {
-		return errors.Wrap(err, "failed to get stepper")
+	stepCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	canceled := make(chan bool, 1)
+	go func() {
+		canceled <- p.watchForCancellation(stepCtx, cancel, done, r.UUID, queued)
+	}()
+
+	// steps that are queued at the same time are the branches of a fan-out,
+	// so they are executed concurrently.
+	results := make([]run.Result, len(queued))
+	errs := make([]error, len(queued))
+	var wg sync.WaitGroup
+	for i := range queued {
+		if steppers[i] == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = p.step(stepCtx, steppers[i], r.UUID, queued[i])
+		}(i)
 	}
+	wg.Wait()
+	close(done)
 
-	if err := run.InputSatisfied(input, stepper.RequiredInput()); err != nil {
-		err2 := p.abortRun(r)
-		if err2 != nil {
-			return errors.Wrap(err2, "failed trying to abort run")
+	if <-canceled {
+		// the run was changed underneath us, so the results of the steps are
+		// discarded and only the claim is released.
+		if err := p.releaseLatest(ctx, r); err != nil {
+			return errors.Wrap(err, "failed to release canceled run")
 		}
-		return errors.Wrap(err, "step is not satisfied with input")
+		return ErrRunCanceled
 	}
 
-	result, err := stepper.Step(input)
-	if err != nil {
-		return errors.Wrap(err, "failed to invoke step")
+	if ctx.Err() != nil {
+		// the engine is shutting down, so the steps were interrupted rather
+		// than having failed. They are left queued to be executed again.
+		if err := p.releaseLatest(context.Background(), r); err != nil {
+			return errors.Wrap(err, "failed to release interrupted run")
+		}
+		return ctx.Err()
+	}
+
+	lastStepComplete := r.LastStepComplete
+	var stepErr error
+	for i, q := range queued {
+		if steppers[i] == nil {
+			continue
+		}
+		if errs[i] != nil {
+			stepErr = errs[i]
+			p.recordStepError(errs[i], r, q.Step)
+			continue
+		}
+		p.updateStep(results[i], r, q.Step, q.Input)
 	}
 
-	return errors.Wrap(p.updateAndReleaseRun(result, r, s, input), "failed to update and release run")
+	switch err := p.releaseRun(ctx, r, queued); err {
+	case nil:
+		p.progressed = r.LastStepComplete != lastStepComplete
+	case ErrRunCanceled:
+		if err := p.releaseLatest(ctx, r); err != nil {
+			return errors.Wrap(err, "failed to release canceled run")
+		}
+		return ErrRunCanceled
+	default:
+		return errors.Wrap(err, "failed to update and release run")
+	}
+
+	if inputErr != nil {
+		return errors.Wrap(inputErr, "step is not satisfied with input")
+	}
+	return errors.Wrap(stepErr, "failed to invoke step")
 }
 
-func (p *Executor) abortRun(r *run.Run) error {
-	r.Abort()
-	return p.runRepo.ReleaseRun(context.TODO(), r)
+// step executes a single step. A step that runs past its timeout fails, no
+// matter what the Stepper returned once its context was cancelled.
+func (p *Executor) step(ctx context.Context, stepper run.ContextStepper, runUUID string, q run.QueuedStep) (run.Result, error) {
+	ctx = run.NewStepContext(ctx, runUUID, q.Step.UUID)
+
+	timeout := p.stepTimeout
+	if q.Step.Timeout > 0 {
+		timeout = time.Duration(q.Step.Timeout)
+	}
+	if timeout <= 0 {
+		return p.invoke(ctx, stepper, q.Input)
+	}
+
+	stepCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	res, err := p.invoke(stepCtx, stepper, q.Input)
+	if ctx.Err() == nil && stepCtx.Err() == context.DeadlineExceeded {
+		return run.Result{State: run.StateFailed, Error: run.TimeoutMessage(timeout)}, nil
+	}
+	return res, err
 }
 
-func (p *Executor) updateAndReleaseRun(result run.Result, r *run.Run, s *run.Step, d run.InputData) error {
+// invoke calls the Stepper and recovers if it panics, so that a bad step can't
+// take down the worker. The panic and its stack trace are recorded in the
+// result of the step, in the state set by the panic policy.
+func (p *Executor) invoke(ctx context.Context, stepper run.ContextStepper, d run.InputData) (res run.Result, err error) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+
+		p.metrics.Count("workflow.executor.panic", 1, []string{
+			fmt.Sprintf("step_type:%s", stepper.Type()),
+		}, 1.0)
+
+		state := run.StateError
+		if p.panicPolicy == PanicFail {
+			state = run.StateFailed
+		}
+		res = run.Result{
+			State: state,
+			Error: fmt.Sprintf("stepper panicked: %v", v),
+			Data: run.InputData{
+				"panic": fmt.Sprint(v),
+				"stack": string(debug.Stack()),
+			},
+		}
+		err = nil
+	}()
+
+	return stepper.StepContext(ctx, d)
+}
 
+// watchForCancellation polls the run until done is closed and cancels the
+// context of the executing steps if the run became terminal or any of the
+// steps is no longer queued, as happens when the run is cancelled through the
+// API or timed out by the watchdog. It returns whether the steps were
+// cancelled.
+func (p *Executor) watchForCancellation(ctx context.Context, cancel context.CancelFunc, done chan struct{}, uuid string, queued []run.QueuedStep) bool {
+	for {
+		select {
+		case <-done:
+			return false
+		case <-ctx.Done():
+			return false
+		case <-time.After(p.cancelPollInterval):
+		}
+
+		latest, err := p.runRepo.GetRun(ctx, uuid)
+		if err != nil {
+			continue
+		}
+		if err := latest.UnmarshalRunData(); err != nil {
+			continue
+		}
+
+		if stillQueued(latest, queued) {
+			continue
+		}
+
+		cancel()
+		return true
+	}
+}
+
+func stillQueued(r *run.Run, queued []run.QueuedStep) bool {
+	if r.State != run.StateQueued {
+		return false
+	}
+
+	for _, q := range queued {
+		s := r.FindStep(q.Step.UUID)
+		if s == nil || s.State != run.StateQueued {
+			return false
+		}
+	}
+	return true
+}
+
+// releaseLatest releases the claim on the latest copy of r without changing
+// it, unless another worker has claimed the run since.
+func (p *Executor) releaseLatest(ctx context.Context, r *run.Run) error {
+	_, err := run.Update(ctx, p.runRepo, r, func(latest *run.Run) error {
+		if !p.owns(latest) {
+			return errNotClaimed
+		}
+		return nil
+	})
+	if err == errNotClaimed {
+		return nil
+	}
+	return err
+}
+
+var errNotClaimed = errors.New("run is claimed by another worker")
+
+func (p *Executor) owns(r *run.Run) bool {
+	return r.ClaimedBy == nil || *r.ClaimedBy == p.workerID
+}
+
+func (p *Executor) abortStep(err error, r *run.Run, s *run.Step, d run.InputData) {
+	n := time.Now().UTC()
+	r.LastStepComplete = &n
+	s.Input = d
+	s.Abort(err.Error())
+}
+
+func (p *Executor) updateStep(result run.Result, r *run.Run, s *run.Step, d run.InputData) {
 	// if we're doing a state transition, update the LastStepComplete timestamp.
 	if s.State != result.State {
 		n := time.Now().UTC()
@@ -102,57 +420,61 @@ func (p *Executor) updateAndReleaseRun(result run.Result, r *run.Run, s *run.Ste
 	s.Input = d
 	s.State = result.State
 	s.Output = result
+	if result.ChildRun != "" {
+		s.ChildRun = result.ChildRun
+	}
+
+	// a parked step isn't executing, so it can't time out while it waits.
+	// Parking it is progress of the run.
+	if result.State == run.StateQueued && (result.WakeAt != nil || result.Signal != "") {
+		n := time.Now().UTC()
+		r.LastStepComplete = &n
+		s.NotBefore = result.WakeAt
+		s.Signal = result.Signal
+		s.Started = nil
+	}
+}
 
-	r.State, r.Rollback = CalculateRunStateTransition(result.State, r.Rollback, s.OnSuccess, s.OnFailure)
+func (p *Executor) recordStepError(err error, r *run.Run, s *run.Step) {
+	n := time.Now().UTC()
+	s.RecordError(err, n)
 
-	return p.runRepo.ReleaseRun(context.TODO(), r)
+	// the step has run out of attempts.
+	if s.State == run.StateError {
+		r.LastStepComplete = &n
+	}
 }
 
-func CalculateRunStateTransition(resultState run.State, isRollback bool, onSuccess, onFailure *run.Step) (run.State, bool) {
-	/* The state transition logic can be described as follows:
-	1. step success?
-		-> have an OnSuccess?
-			-> execute the on success (run state -> queued)
-		-> don't have an onSuccess?
-			-> is this executing a current rollback?
-				-> yes?
-					-> run state is now failed (since it was a rollback)
-				-> no?
-					-> run state is now success (since not a rollback)
-	2. step failure?
-		-> have an OnFailure?
-			-> run state is now queued, rollback = true
-		-> don't have an OnFailure?
-			-> run state is now error (no way to handle this failure)
-	3. step errpr?
-		-> go to error state, do not attempt rollback.
-	*/
-	switch resultState {
-	case run.StateFailed:
-		if onFailure == nil {
-			return run.StateError, isRollback
-		}
-		return run.StateQueued, true
-	case run.StateSuccess:
-		if onSuccess == nil {
-			if isRollback {
-				return run.StateFailed, isRollback
+// releaseRun resolves the state of r and releases it. If the run was modified
+// while its steps were executing, such as by the watchdog, the outcome of the
+// steps is applied to the latest copy of the run instead. ErrRunCanceled is
+// returned when the steps themselves were changed in the meantime.
+func (p *Executor) releaseRun(ctx context.Context, r *run.Run, queued []run.QueuedStep) error {
+	_, err := run.Update(ctx, p.runRepo, r, func(latest *run.Run) error {
+		if latest != r {
+			if !p.owns(latest) || !stillQueued(latest, queued) {
+				return ErrRunCanceled
+			}
+			for _, q := range queued {
+				latest.FindStep(q.Step.UUID).Apply(q.Step)
+			}
+			if r.LastStepComplete != nil {
+				latest.LastStepComplete = r.LastStepComplete
 			}
-			return run.StateSuccess, isRollback
-		} else {
-			return run.StateQueued, isRollback
 		}
-	case run.StateError:
-		return run.StateError, isRollback
-	}
-	// state is still queued - no change to the state or rollback status.
-	return run.StateQueued, isRollback
+
+		latest.Resolve()
+		return nil
+	})
+	return err
 }
 
-func (p *Executor) getStepper(s *run.Step) (run.Stepper, error) {
-	return p.stepperStore.Get(s.StepType)
+// CalculateRunStateTransition calculates the state of a run after a single
+// step finishes. See run.Transition for the rules that are applied.
+func CalculateRunStateTransition(resultState run.State, isRollback bool, onSuccess, onFailure *run.Step) (run.State, bool) {
+	return run.Transition(resultState, isRollback, onSuccess, onFailure)
 }
 
-func (p *Executor) nextRun(ctx context.Context) (*run.Run, error) {
-	return Prioritize(ctx, p.runRepo)
+func (p *Executor) getStepper(s *run.Step) (run.ContextStepper, error) {
+	return p.stepperStore.Get(s.StepType)
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/mitchfriedman/workflow/lib/control"
 	"github.com/mitchfriedman/workflow/lib/engine"
 	"github.com/mitchfriedman/workflow/lib/run"
 	"github.com/mitchfriedman/workflow/lib/testhelpers"
@@ -121,3 +122,399 @@ func ensureStepsContainInput(t *testing.T, s *run.Step) {
 	ensureStepsContainInput(t, s.OnSuccess)
 	ensureStepsContainInput(t, s.OnFailure)
 }
+
+func TestExecutor_InvalidInput(t *testing.T) {
+	repo := testhelpers.NewMemoryRepo()
+	ss := testhelpers.CreateStepperStore()
+	hello := testhelpers.NewSampleStep(run.Result{State: run.StateSuccess}, "say_hello", nil).(*testhelpers.SampleStep)
+	hello.Required = []run.Input{{Name: "count", Type: run.InputTypeInt}}
+	ss.Register(hello)
+
+	r := testhelpers.CreateSampleRun("job", "s1", run.InputData{"count": "ten"})
+	assert.Nil(t, repo.CreateRun(context.Background(), r))
+
+	executor := engine.NewExecutor("123", repo, ss)
+	err := executor.Execute(context.Background())
+	assert.NotNil(t, err)
+
+	found, err := repo.GetRun(context.Background(), r.UUID)
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateError, found.State)
+	assert.Nil(t, found.ClaimedBy)
+	assert.Equal(t, run.StateError, found.Steps.State)
+	assert.Contains(t, found.Steps.Output.Data.UnmarshalString("failure_message"), "count")
+}
+
+func TestExecutor_Context(t *testing.T) {
+	t.Run("step deadline", func(t *testing.T) {
+		repo := testhelpers.NewMemoryRepo()
+		ss := testhelpers.CreateStepperStore()
+		hello := testhelpers.NewBlockingStep("say_hello")
+		ss.RegisterContext(hello)
+
+		r := testhelpers.CreateSampleRun("job", "s1", run.InputData{})
+		assert.Nil(t, repo.CreateRun(context.Background(), r))
+
+		executor := engine.NewExecutor("123", repo, ss, engine.WithStepTimeout(10*time.Millisecond))
+		assert.Nil(t, executor.Execute(context.Background()))
+
+		ctx := <-hello.Started
+		assert.Equal(t, r.UUID, run.RunUUIDFromContext(ctx))
+		assert.Equal(t, r.Steps.UUID, run.StepUUIDFromContext(ctx))
+		assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+
+		found, err := repo.GetRun(context.Background(), r.UUID)
+		assert.Nil(t, err)
+		assert.Equal(t, run.StateQueued, found.State)
+		assert.True(t, found.Rollback)
+		assert.Equal(t, run.StateFailed, found.Steps.State)
+		assert.Equal(t, "step timed out after 10ms", found.Steps.Output.Data.UnmarshalString("failure_message"))
+		assert.NotNil(t, found.Steps.Started)
+	})
+
+	t.Run("step template timeout", func(t *testing.T) {
+		repo := testhelpers.NewMemoryRepo()
+		ss := testhelpers.CreateStepperStore()
+		hello := testhelpers.NewBlockingStep("say_hello")
+		ss.RegisterContext(hello)
+
+		r := testhelpers.CreateSampleRun("job", "s1", run.InputData{})
+		r.Steps.Timeout = run.Duration(10 * time.Millisecond)
+		assert.Nil(t, repo.CreateRun(context.Background(), r))
+
+		executor := engine.NewExecutor("123", repo, ss, engine.WithStepTimeout(time.Hour))
+		assert.Nil(t, executor.Execute(context.Background()))
+
+		found, err := repo.GetRun(context.Background(), r.UUID)
+		assert.Nil(t, err)
+		assert.Equal(t, run.StateFailed, found.Steps.State)
+		assert.Equal(t, "step timed out after 10ms", found.Steps.Output.Data.UnmarshalString("failure_message"))
+		assert.Equal(t, found.Steps.OnFailure, found.CurrentStep())
+	})
+
+	t.Run("run canceled while executing", func(t *testing.T) {
+		repo := testhelpers.NewMemoryRepo()
+		ss := testhelpers.CreateStepperStore()
+		hello := testhelpers.NewBlockingStep("say_hello")
+		ss.RegisterContext(hello)
+
+		r := testhelpers.CreateSampleRun("job", "s1", run.InputData{})
+		assert.Nil(t, repo.CreateRun(context.Background(), r))
+
+		go func() {
+			<-hello.Started
+			found, err := repo.GetRun(context.Background(), r.UUID)
+			assert.Nil(t, err)
+			assert.Nil(t, found.Cancel("canceled by user"))
+			assert.Nil(t, repo.ReleaseRun(context.Background(), found))
+		}()
+
+		executor := engine.NewExecutor("123", repo, ss, engine.WithCancelPollInterval(10*time.Millisecond))
+		err := executor.Execute(context.Background())
+		assert.Equal(t, engine.ErrRunCanceled, err)
+
+		found, err := repo.GetRun(context.Background(), r.UUID)
+		assert.Nil(t, err)
+		assert.Equal(t, run.StateError, found.State)
+		assert.Equal(t, run.StateFailed, found.Steps.State)
+		assert.Equal(t, 0, found.Steps.Attempts)
+		assert.Nil(t, found.ClaimedBy)
+	})
+
+	t.Run("step skipped while executing", func(t *testing.T) {
+		repo := testhelpers.NewMemoryRepo()
+		ss := testhelpers.CreateStepperStore()
+		hello := testhelpers.NewBlockingStep("say_hello")
+		ss.RegisterContext(hello)
+
+		r := testhelpers.CreateSampleRun("job", "s1", run.InputData{})
+		assert.Nil(t, repo.CreateRun(context.Background(), r))
+
+		go func() {
+			<-hello.Started
+			found, err := repo.GetRun(context.Background(), r.UUID)
+			assert.Nil(t, err)
+			skipped, err := run.Modify(context.Background(), repo, found, func(r *run.Run) error {
+				return r.Skip(r.Steps.UUID, run.InputData{"greeting": "hi"}, "stuck", time.Now().UTC())
+			})
+			assert.Nil(t, err)
+			// no other worker can claim the run until the step is cancelled.
+			assert.Equal(t, "123", *skipped.ClaimedBy)
+		}()
+
+		executor := engine.NewExecutor("123", repo, ss, engine.WithCancelPollInterval(10*time.Millisecond))
+		err := executor.Execute(context.Background())
+		assert.Equal(t, engine.ErrRunCanceled, err)
+
+		found, err := repo.GetRun(context.Background(), r.UUID)
+		assert.Nil(t, err)
+		assert.Equal(t, run.StateQueued, found.State)
+		assert.Equal(t, run.StateSuccess, found.Steps.State)
+		assert.Equal(t, "hi", found.Steps.Output.Data.UnmarshalString("greeting"))
+		assert.Equal(t, found.Steps.OnSuccess, found.CurrentStep())
+		assert.Nil(t, found.ClaimedBy)
+	})
+
+	t.Run("engine shutting down", func(t *testing.T) {
+		repo := testhelpers.NewMemoryRepo()
+		ss := testhelpers.CreateStepperStore()
+		hello := testhelpers.NewBlockingStep("say_hello")
+		ss.RegisterContext(hello)
+
+		r := testhelpers.CreateSampleRun("job", "s1", run.InputData{})
+		assert.Nil(t, repo.CreateRun(context.Background(), r))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-hello.Started
+			cancel()
+		}()
+
+		executor := engine.NewExecutor("123", repo, ss)
+		err := executor.Execute(ctx)
+		assert.Equal(t, context.Canceled, err)
+
+		found, err := repo.GetRun(context.Background(), r.UUID)
+		assert.Nil(t, err)
+		assert.Equal(t, run.StateQueued, found.State)
+		assert.Equal(t, run.StateQueued, found.Steps.State)
+		assert.Equal(t, 0, found.Steps.Attempts)
+		assert.Nil(t, found.ClaimedBy)
+	})
+}
+
+// modifyingStep modifies its run while it executes, like an operator or the
+// watchdog would, and then succeeds. With keepClaim, the run is written the
+// way the API writes it, without releasing the claim of the worker.
+type modifyingStep struct {
+	repo      *testhelpers.MemoryRepo
+	modify    func(r *run.Run)
+	keepClaim bool
+}
+
+func (s *modifyingStep) Type() string               { return "say_hello" }
+func (s *modifyingStep) RequiredInput() []run.Input { return []run.Input{} }
+
+func (s *modifyingStep) StepContext(ctx context.Context, d run.InputData) (run.Result, error) {
+	r, err := s.repo.GetRun(ctx, run.RunUUIDFromContext(ctx))
+	if err != nil {
+		return run.Result{}, err
+	}
+	if s.modify != nil {
+		s.modify(r)
+	}
+	write := s.repo.ReleaseRun
+	if s.keepClaim {
+		write = s.repo.SaveRun
+	}
+	if err := write(ctx, r); err != nil {
+		return run.Result{}, err
+	}
+	return run.Result{State: run.StateSuccess, Data: run.InputData{"greeting": "hello"}}, nil
+}
+
+func TestExecutor_Conflict(t *testing.T) {
+	repo := testhelpers.NewMemoryRepo()
+	ss := testhelpers.CreateStepperStore()
+	ss.RegisterContext(&modifyingStep{repo: repo})
+
+	r := testhelpers.CreateSampleRun("job", "s1", run.InputData{})
+	assert.Nil(t, repo.CreateRun(context.Background(), r))
+
+	executor := engine.NewExecutor("123", repo, ss)
+	assert.Nil(t, executor.Execute(context.Background()))
+
+	// the outcome of the step is applied to the modified run.
+	found, err := repo.GetRun(context.Background(), r.UUID)
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateQueued, found.State)
+	assert.Equal(t, run.StateSuccess, found.Steps.State)
+	assert.Equal(t, "hello", found.Steps.Output.Data["greeting"])
+	assert.Nil(t, found.ClaimedBy)
+	assert.Equal(t, found.Steps.OnSuccess, found.CurrentStep())
+}
+
+func TestExecutor_Pause(t *testing.T) {
+	repo := testhelpers.NewMemoryRepo()
+	ss := testhelpers.CreateStepperStore()
+	ss.RegisterContext(&modifyingStep{repo: repo, keepClaim: true, modify: func(r *run.Run) {
+		assert.Nil(t, r.Pause(time.Now().UTC()))
+		assert.Equal(t, "123", *r.ClaimedBy)
+	}})
+
+	r := testhelpers.CreateSampleRun("job", "s1", run.InputData{})
+	assert.Nil(t, repo.CreateRun(context.Background(), r))
+
+	// the run is paused while its step executes, which is allowed to finish.
+	executor := engine.NewExecutor("123", repo, ss)
+	assert.Nil(t, executor.Execute(context.Background()))
+
+	found, err := repo.GetRun(context.Background(), r.UUID)
+	assert.Nil(t, err)
+	assert.True(t, found.Paused)
+	assert.Equal(t, run.StateSuccess, found.Steps.State)
+	assert.Nil(t, found.ClaimedBy)
+
+	// it isn't claimed again until it's resumed.
+	assert.Equal(t, engine.ErrNoRuns, executor.Execute(context.Background()))
+
+	assert.Nil(t, found.Resume(time.Now().UTC()))
+	assert.Nil(t, repo.ReleaseRun(context.Background(), found))
+	assert.Nil(t, executor.Execute(context.Background()))
+
+	found, err = repo.GetRun(context.Background(), r.UUID)
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateSuccess, found.Steps.OnSuccess.State)
+}
+
+type panickingStep struct{}
+
+func (s *panickingStep) Type() string               { return "say_hello" }
+func (s *panickingStep) RequiredInput() []run.Input { return []run.Input{} }
+
+func (s *panickingStep) Step(d run.InputData) (run.Result, error) {
+	panic("boom")
+}
+
+func TestExecutor_Panic(t *testing.T) {
+	tests := map[string]struct {
+		options       []engine.ExecutorOption
+		wantStepState run.State
+		wantRunState  run.State
+	}{
+		"by default":           {nil, run.StateError, run.StateError},
+		"with the fail policy": {[]engine.ExecutorOption{engine.WithPanicPolicy(engine.PanicFail)}, run.StateFailed, run.StateQueued},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			repo := testhelpers.NewMemoryRepo()
+			ss := testhelpers.CreateStepperStore()
+			ss.Register(&panickingStep{})
+
+			r := testhelpers.CreateSampleRun("job", "s1", run.InputData{})
+			assert.Nil(t, repo.CreateRun(context.Background(), r))
+
+			executor := engine.NewExecutor("123", repo, ss, tc.options...)
+			assert.Nil(t, executor.Execute(context.Background()))
+
+			found, err := repo.GetRun(context.Background(), r.UUID)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantRunState, found.State)
+			assert.Nil(t, found.ClaimedBy)
+
+			out := found.Steps.Output.Data
+			assert.Equal(t, tc.wantStepState, found.Steps.State)
+			assert.Equal(t, "stepper panicked: boom", out.UnmarshalString("failure_message"))
+			assert.Equal(t, "boom", out.UnmarshalString("panic"))
+			assert.Contains(t, out.UnmarshalString("stack"), "panickingStep")
+		})
+	}
+}
+
+// wakingStep calls onWake, if set, before executing the Stepper.
+type wakingStep struct {
+	run.Stepper
+	onWake func(ctx context.Context)
+}
+
+func (s *wakingStep) StepContext(ctx context.Context, d run.InputData) (run.Result, error) {
+	if s.onWake != nil {
+		s.onWake(ctx)
+	}
+	return s.Step(d)
+}
+
+func TestExecutor_Sleep(t *testing.T) {
+	repo := testhelpers.NewMemoryRepo()
+	ss := testhelpers.CreateStepperStore()
+	sleeper := &wakingStep{Stepper: run.NewSleepStepper()}
+	ss.RegisterContext(sleeper)
+
+	j := run.NewJob("job", &run.Step{StepType: run.SleepStepperType, Input: run.InputData{"duration": "1h"}})
+	r := run.NewRun(j, run.Trigger{JobName: "job", Scope: "s1"})
+	assert.Nil(t, repo.CreateRun(context.Background(), r))
+
+	executor := engine.NewExecutor("123", repo, ss)
+	assert.Nil(t, executor.Execute(context.Background()))
+
+	found, err := repo.GetRun(context.Background(), r.UUID)
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateQueued, found.Steps.State)
+	assert.Nil(t, found.ClaimedBy)
+	assert.Nil(t, found.Steps.Started)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *found.Steps.NotBefore, time.Minute)
+	assert.WithinDuration(t, time.Now(), *found.LastStepComplete, time.Minute)
+
+	// the run isn't executed while the step sleeps.
+	assert.Equal(t, engine.ErrNoRuns, executor.Execute(context.Background()))
+
+	// the hour spent asleep doesn't count against the progress of the run
+	// once the step wakes up.
+	woken := time.Now().UTC().Add(-time.Second)
+	parked := woken.Add(-time.Hour)
+	found.Steps.NotBefore = &woken
+	found.LastStepComplete = &parked
+	assert.Nil(t, repo.ReleaseRun(context.Background(), found))
+
+	assert.True(t, found.Steps.Parked())
+	sleeper.onWake = func(ctx context.Context) {
+		claimed, err := repo.GetRun(ctx, run.RunUUIDFromContext(ctx))
+		assert.Nil(t, err)
+		assert.WithinDuration(t, time.Now(), *claimed.LastStepComplete, time.Minute)
+	}
+	assert.Nil(t, executor.Execute(context.Background()))
+
+	found, err = repo.GetRun(context.Background(), r.UUID)
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateSuccess, found.Steps.State)
+	assert.Equal(t, run.StateSuccess, found.State)
+}
+
+func TestExecutor_Compensate(t *testing.T) {
+	repo := testhelpers.NewMemoryRepo()
+	ss := run.NewStepperStore()
+	ss.Register(testhelpers.NewSampleStep(run.Result{State: run.StateSuccess}, "reserve", nil))
+	ss.Register(testhelpers.NewSampleStep(run.Result{State: run.StateFailed}, "ship", nil))
+	ss.Register(testhelpers.NewSampleStep(run.Result{State: run.StateSuccess}, "unreserve", nil))
+
+	reserve := testhelpers.CreateStep("reserve")
+	reserve.Compensate = "unreserve"
+	reserve.OnSuccess = testhelpers.CreateStep("ship")
+	r := run.NewRun(run.NewJob("order", reserve), run.Trigger{JobName: "order", Scope: "s1"})
+	assert.Nil(t, repo.CreateRun(context.Background(), r))
+
+	executor := engine.NewExecutor("123", repo, ss)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, executor.Execute(context.Background()))
+	}
+	assert.Equal(t, engine.ErrNoRuns, executor.Execute(context.Background()))
+
+	found, err := repo.GetRun(context.Background(), r.UUID)
+	assert.Nil(t, err)
+	assert.Nil(t, found.UnmarshalRunData())
+	assert.Equal(t, run.StateFailed, found.State)
+
+	compensations := found.Compensations()
+	if assert.Len(t, compensations, 1) {
+		assert.Equal(t, run.StateSuccess, compensations[0].Step.State)
+		assert.Equal(t, found.Steps.UUID, compensations[0].Compensates)
+	}
+}
+
+func TestExecutor_Controls(t *testing.T) {
+	repo := testhelpers.NewMemoryRepo()
+	cr := testhelpers.NewMemoryControlRepo()
+	ss := testhelpers.CreateStepperStore()
+
+	r := testhelpers.CreateSampleRun("job", "s1", run.InputData{})
+	assert.Nil(t, repo.CreateRun(context.Background(), r))
+	assert.Nil(t, cr.Pause(context.Background(), &control.Control{JobName: "job", Reason: "incident"}))
+
+	executor := engine.NewExecutor("123", repo, ss, engine.WithControls(cr))
+	assert.Equal(t, engine.ErrNoRuns, executor.Execute(context.Background()))
+
+	assert.Nil(t, cr.Resume(context.Background(), "job", ""))
+	assert.Nil(t, executor.Execute(context.Background()))
+}
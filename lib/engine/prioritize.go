@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"time"
 
+	"github.com/mitchfriedman/workflow/lib/control"
 	"github.com/mitchfriedman/workflow/lib/run"
 
 	"github.com/pkg/errors"
@@ -18,7 +20,14 @@ func Prioritize(ctx context.Context, retriever run.Retriever) (*run.Run, error)
 		return nil, errors.Wrap(err, "failed to fetch next runs")
 	}
 
+	return PrioritizeRuns(runs), nil
+}
+
+// PrioritizeRuns determines the best run to execute out of the queued runs. It
+// is the run.Prioritizer used to claim runs atomically.
+func PrioritizeRuns(runs []*run.Run) *run.Run {
 	runQueues := make(map[string][]*run.Run)
+	now := time.Now().UTC()
 
 	keyName := func(r *run.Run) string {
 		return fmt.Sprintf("%s-%s", r.JobName, r.Scope)
@@ -26,8 +35,14 @@ func Prioritize(ctx context.Context, retriever run.Retriever) (*run.Run, error)
 
 	// there is a queue of runs by the combination of the job name and the
 	// scope of the run. In other words, different scopes of the same job
-	// name can run concurrently.
+	// name can run concurrently. Runs that are parked, on a sleep, a signal or
+	// an approval, are left out like dormant runs so that they don't hold up
+	// the rest of their queue until they wake up. A run waiting to retry a
+	// step still holds up its queue.
 	for _, r := range runs {
+		if r.Dormant(now) || parked(r, now) {
+			continue
+		}
 		k := keyName(r)
 		runQueues[k] = append(runQueues[k], r)
 	}
@@ -60,12 +75,32 @@ func Prioritize(ctx context.Context, retriever run.Retriever) (*run.Run, error)
 		})
 
 		// make sure that other runs of the same job + scope are queued behind the currently executing one so that
-		// only one run of the job+scope is being executed at time.
-		if len(rs) > 0 && rs[0].ClaimedBy == nil {
-			return rs[0], nil
+		// only one run of the job+scope is being executed at time. The same goes for a run that is waiting to
+		// retry a step, or that is paused.
+		if len(rs) > 0 && rs[0].ClaimedBy == nil && !rs[0].Paused && rs[0].Eligible(now) {
+			return rs[0]
 		}
 	}
 
 	// no runs to execute - not an error.
-	return nil, nil
+	return nil
+}
+
+// parked reports whether a run that isn't claimed or paused is parked.
+func parked(r *run.Run, now time.Time) bool {
+	return r.ClaimedBy == nil && !r.Paused && r.Parked(now)
+}
+
+// SkipPaused wraps p so that the runs of the queues paused by controls are
+// never picked.
+func SkipPaused(p run.Prioritizer, controls []control.Control) run.Prioritizer {
+	return func(runs []*run.Run) *run.Run {
+		var active []*run.Run
+		for _, r := range runs {
+			if len(control.Matching(controls, r.JobName, r.Scope)) == 0 {
+				active = append(active, r)
+			}
+		}
+		return p(active)
+	}
 }
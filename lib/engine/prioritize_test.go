@@ -3,9 +3,11 @@ package engine_test
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/mitchfriedman/workflow/lib/control"
 	"github.com/mitchfriedman/workflow/lib/engine"
 	"github.com/mitchfriedman/workflow/lib/run"
 	"github.com/stretchr/testify/assert"
@@ -18,6 +20,7 @@ func TestPrioritize(t *testing.T) {
 	j2s1 := testhelpers.CreateSampleRun("job", "s1", make(run.InputData))
 	j3s1 := testhelpers.CreateSampleRun("job", "s1", make(run.InputData))
 	j4s1 := testhelpers.CreateSampleRun("job", "s1", make(run.InputData))
+	j5s1 := testhelpers.CreateSampleRun("job", "s1", make(run.InputData))
 	n := time.Now().UTC()
 	later := time.Now().UTC().Add(10 * time.Second)
 	workerId := "123"
@@ -25,6 +28,8 @@ func TestPrioritize(t *testing.T) {
 	j4s1.LastStepComplete = &n
 	j4s1.ClaimedUntil = &later
 	j4s1.ClaimedBy = &workerId
+	j5s1.LastStepComplete = &n
+	j5s1.Steps.NotBefore = &later
 
 	tests := map[string]struct {
 		runs        []*run.Run
@@ -35,6 +40,7 @@ func TestPrioritize(t *testing.T) {
 		"multiple of same run+scope, none started":                      {runs: []*run.Run{j1s1, j2s1}, expectedRun: &j1s1.UUID},
 		"multiple of same run+scope, 1 already started but not claimed": {runs: []*run.Run{j1s1, j3s1}, expectedRun: &j3s1.UUID},
 		"multiple of same run+scope, 1 claimed being executed":          {runs: []*run.Run{j1s1, j4s1}, expectedRun: nil},
+		"multiple of same run+scope, 1 started waiting to retry":        {runs: []*run.Run{j1s1, j5s1}, expectedRun: nil},
 	}
 
 	for name, tc := range tests {
@@ -59,3 +65,114 @@ func TestPrioritize(t *testing.T) {
 	}
 
 }
+
+func TestPrioritizeRuns(t *testing.T) {
+	j1s1 := testhelpers.CreateSampleRun("job", "s1", make(run.InputData))
+	j2s1 := testhelpers.CreateSampleRun("job", "s1", make(run.InputData))
+	j3s1 := testhelpers.CreateSampleRun("job", "s1", make(run.InputData))
+	j1s2 := testhelpers.CreateSampleRun("job", "s2", make(run.InputData))
+	dormant := testhelpers.CreateSampleRun("job", "s1", make(run.InputData))
+	n := time.Now().UTC()
+	later := n.Add(time.Hour)
+	dormant.NotBefore = &later
+	paused := testhelpers.CreateSampleRun("job", "s3", make(run.InputData))
+	paused.LastStepComplete = &n
+	paused.Paused = true
+	j2s3 := testhelpers.CreateSampleRun("job", "s3", make(run.InputData))
+	sleeping := testhelpers.CreateSampleRun("job", "s4", make(run.InputData))
+	sleeping.LastStepComplete = &n
+	sleeping.Steps.NotBefore = &later
+	sleeping.Steps.Output.WakeAt = &later
+	j2s4 := testhelpers.CreateSampleRun("job", "s4", make(run.InputData))
+	retrying := testhelpers.CreateSampleRun("job", "s5", make(run.InputData))
+	retrying.LastStepComplete = &n
+	retrying.Steps.NotBefore = &later
+	j2s5 := testhelpers.CreateSampleRun("job", "s5", make(run.InputData))
+	workerId := "123"
+	j1s1.Started = n.Add(-time.Minute)
+	j2s1.Started = n
+	j3s1.LastStepComplete = &n
+	j3s1.ClaimedBy = &workerId
+
+	tests := map[string]struct {
+		runs        []*run.Run
+		expectedRun *run.Run
+	}{
+		"no runs":                         {runs: nil, expectedRun: nil},
+		"earliest of the queue":           {runs: []*run.Run{j2s1, j1s1}, expectedRun: j1s1},
+		"queue with a claimed run":        {runs: []*run.Run{j1s1, j3s1}, expectedRun: nil},
+		"another queue than a busy queue": {runs: []*run.Run{j1s1, j3s1, j1s2}, expectedRun: j1s2},
+		"only a dormant run":              {runs: []*run.Run{dormant}, expectedRun: nil},
+		"past a dormant run":              {runs: []*run.Run{dormant, j2s1}, expectedRun: j2s1},
+		"queue with a paused run":         {runs: []*run.Run{j2s3, paused}, expectedRun: nil},
+		"only a sleeping run":             {runs: []*run.Run{sleeping}, expectedRun: nil},
+		"past a sleeping run":             {runs: []*run.Run{sleeping, j2s4}, expectedRun: j2s4},
+		"queue with a retrying run":       {runs: []*run.Run{j2s5, retrying}, expectedRun: nil},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedRun, engine.PrioritizeRuns(tc.runs))
+		})
+	}
+}
+
+func TestClaimNextRun(t *testing.T) {
+	db, closer := testhelpers.DBConnection(t, false)
+	defer closer()
+	rr := run.NewDatabaseStorage(db)
+
+	for _, scope := range []string{"s1", "s1", "s2"} {
+		assert.Nil(t, rr.CreateRun(context.Background(), testhelpers.CreateSampleRun("job", scope, make(run.InputData))))
+	}
+
+	// many workers claim at once, but only one run of each job+scope can be
+	// claimed at a time.
+	claimed := make(chan *run.Run, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(claimed); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r, err := rr.ClaimNextRun(context.Background(), fmt.Sprintf("worker-%d", i), time.Minute, engine.PrioritizeRuns)
+			assert.Nil(t, err)
+			if r != nil {
+				claimed <- r
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(claimed)
+
+	scopes := make(map[string]int)
+	for r := range claimed {
+		assert.NotNil(t, r.ClaimedBy)
+		scopes[r.Scope]++
+	}
+	assert.Equal(t, map[string]int{"s1": 1, "s2": 1}, scopes)
+}
+
+func TestSkipPaused(t *testing.T) {
+	deploy := testhelpers.CreateSampleRun("deploy", "s1", make(run.InputData))
+	build := testhelpers.CreateSampleRun("build", "s1", make(run.InputData))
+
+	tests := map[string]struct {
+		controls    []control.Control
+		runs        []*run.Run
+		expectedRun *run.Run
+	}{
+		"without controls":          {nil, []*run.Run{deploy}, deploy},
+		"with a paused job":         {[]control.Control{{JobName: "deploy"}}, []*run.Run{deploy}, nil},
+		"with another paused scope": {[]control.Control{{JobName: "deploy", Scope: "s2"}}, []*run.Run{deploy}, deploy},
+		"past a paused job":         {[]control.Control{{JobName: "deploy"}}, []*run.Run{deploy, build}, build},
+		"with everything paused":    {[]control.Control{{}}, []*run.Run{deploy, build}, nil},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedRun, engine.SkipPaused(engine.PrioritizeRuns, tc.controls)(tc.runs))
+		})
+	}
+}
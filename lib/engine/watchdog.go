@@ -2,7 +2,6 @@ package engine
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/mitchfriedman/workflow/lib/logging"
@@ -66,37 +65,54 @@ func cleanupRuns(ctx context.Context, rr run.Repo, wr worker.Repo, runExpiry tim
 	}
 
 	for _, r := range runs {
-		// if it's currently unclaimed, there's nothing to do for this run.
-		if r.ClaimedBy == nil && r.ClaimedUntil == nil {
-			continue
+		// if the run changed since it was fetched, it is checked again with a
+		// fresh copy before being released.
+		_, err := run.Update(ctx, rr, r, func(r *run.Run) error {
+			return cleanupRun(ctx, r, wr, runExpiry)
+		})
+		switch err {
+		case nil, errNothingToCleanup:
+		default:
+			return errors.Wrapf(err, "cleanupRuns: failed to release run: %v", r)
 		}
+	}
 
-		// if the run is not making progress for longer than the expiry time, let's time it out and move it into
-		// the failure state.
-		if r.LastStepComplete != nil && time.Now().Sub(*r.LastStepComplete) > runExpiry {
-			r.Fail(fmt.Sprintf("step timed out after %s", runExpiry.String()))
-			if err := rr.ReleaseRun(ctx, r); err != nil {
-				return errors.Wrapf(err, "cleanupRuns: failed to abort and release run: %v", r)
-			}
-			continue
-		}
+	return nil
+}
 
-		// fetch this worker and see if it is still around.
-		w, err := wr.Get(ctx, *r.ClaimedBy)
-		if err != nil {
-			return errors.Wrapf(err, "cleanupRuns: failed to get run: %v", r)
-		}
+var errNothingToCleanup = errors.New("nothing to clean up")
 
-		// the worker is present.
-		if w != nil {
-			continue
-		}
+// cleanupRun updates a run that is due to be released, or returns
+// errNothingToCleanup if the run should be left as it is.
+func cleanupRun(ctx context.Context, r *run.Run, wr worker.Repo, runExpiry time.Duration) error {
+	// if it's currently unclaimed, there's nothing to do for this run.
+	if r.ClaimedBy == nil && r.ClaimedUntil == nil {
+		return errNothingToCleanup
+	}
 
-		// the worker is no longer with us, let's release this run and let another claim it.
-		if err := rr.ReleaseRun(ctx, r); err != nil {
-			return errors.Wrapf(err, "cleanupRuns: failed to release run: %v", r)
-		}
+	// the worker should have timed out its steps, but it may be stuck.
+	if r.TimeoutSteps(time.Now().UTC()) {
+		return nil
+	}
+
+	// if the run is not making progress for longer than the expiry time, let's time it out and move it into
+	// the failure state. A paused run isn't expected to make progress.
+	if !r.Paused && r.LastStepComplete != nil && time.Now().Sub(*r.LastStepComplete) > runExpiry {
+		r.Fail(run.TimeoutMessage(runExpiry))
+		return nil
+	}
+
+	// fetch this worker and see if it is still around.
+	w, err := wr.Get(ctx, *r.ClaimedBy)
+	if err != nil {
+		return errors.Wrapf(err, "cleanupRuns: failed to get run: %v", r)
+	}
+
+	// the worker is present.
+	if w != nil {
+		return errNothingToCleanup
 	}
 
+	// the worker is no longer with us, let's release this run and let another claim it.
 	return nil
 }
@@ -0,0 +1,125 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mitchfriedman/workflow/lib/logging"
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/tracing"
+)
+
+// ApprovalRepresentation is a JSON API response of a pending approval.
+type ApprovalRepresentation struct {
+	Approvers   []string   `json:"approvers"`
+	Deadline    *time.Time `json:"deadline"`
+	Job         string     `json:"job"`
+	RequestedAt *time.Time `json:"requested_at"`
+	RunUUID     string     `json:"run_uuid"`
+	Scope       string     `json:"scope"`
+	StepType    string     `json:"step_type"`
+	StepUUID    string     `json:"step_uuid"`
+}
+
+type decisionRequest struct {
+	// Approver is asserted by the caller. It's ignored when the router takes
+	// the approver from a header instead, see WithApproverHeader.
+	Approver string `json:"approver"`
+	Comment  string `json:"comment"`
+}
+
+// BuildGetApprovalsHandler builds a HandlerFunc that lists the approval steps
+// of every queued run that are waiting for a decision.
+func BuildGetApprovalsHandler(rr run.Repo, logger logging.StructuredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		span, ctx := tracing.NewServiceSpan(r.Context(), "get_approvals")
+		defer span.Finish()
+
+		runs, err := rr.NextRuns(ctx)
+		if err != nil {
+			span.RecordError(err)
+			logger.Errorf("failed to get queued runs - %v", err)
+			respondErr(w, Error(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		reps := make([]ApprovalRepresentation, 0)
+		for _, found := range runs {
+			for _, a := range found.PendingApprovals() {
+				reps = append(reps, ApprovalRepresentation{
+					Approvers:   a.Approvers,
+					Deadline:    a.Deadline,
+					Job:         a.JobName,
+					RequestedAt: a.RequestedAt,
+					RunUUID:     a.RunUUID,
+					Scope:       a.Scope,
+					StepType:    a.Step.StepType,
+					StepUUID:    a.Step.UUID,
+				})
+			}
+		}
+
+		respond(w, http.StatusOK, reps)
+	}
+}
+
+// BuildDecideHandler builds a HandlerFunc that approves, or rejects, an
+// approval step of a run on behalf of the approver. The approver is taken
+// from the approverHeader when it's set, and otherwise from the request body,
+// where it is only asserted by the caller and can't be trusted for auditing.
+func BuildDecideHandler(rr run.Repo, approved bool, approverHeader string, logger logging.StructuredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		uuid := params["uuid"]
+		stepUUID := params["step_uuid"]
+		span, ctx := tracing.NewServiceSpan(r.Context(), "decide_approval")
+		defer span.Finish()
+		span.SetTag("uuid", uuid)
+		span.SetTag("step_uuid", stepUUID)
+		span.SetTag("approved", approved)
+
+		defer r.Body.Close()
+		var req decisionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondErr(w, Error(http.StatusBadRequest, "failed to parse decision: "+err.Error()))
+			return
+		}
+		if approverHeader != "" {
+			req.Approver = r.Header.Get(approverHeader)
+			if req.Approver == "" {
+				respondErr(w, Error(http.StatusUnauthorized, "missing approver header: '"+approverHeader+"'"))
+				return
+			}
+		}
+		if req.Approver == "" {
+			respondErr(w, Error(http.StatusBadRequest, "missing required field: 'approver'"))
+			return
+		}
+
+		d := run.Decision{
+			Approver: req.Approver,
+			Approved: approved,
+			Comment:  req.Comment,
+			Decided:  time.Now().UTC(),
+		}
+		updateRun(ctx, w, span, rr, logger, uuid, func(r *run.Run) error {
+			if r.ClaimedBy != nil {
+				return errRunClaimed
+			}
+
+			switch err := r.Decide(stepUUID, d); err {
+			case nil:
+				return nil
+			case run.ErrNotApprover:
+				return Error(http.StatusForbidden, err.Error())
+			case run.ErrNoPendingApproval:
+				return Error(http.StatusConflict, err.Error())
+			default:
+				return err
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mitchfriedman/workflow/lib/logging"
+	"github.com/mitchfriedman/workflow/lib/rest"
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createPendingApproval(t *testing.T, rr run.Repo) *run.Run {
+	t.Helper()
+	r := testhelpers.CreateSampleRun("deploy", "production", make(run.InputData))
+	input := run.InputData{"step_uuid": r.Steps.UUID, "approvers": []string{"jane"}}
+	res, err := run.NewApprovalStepper().Step(input)
+	assert.Nil(t, err)
+	r.Steps.Input = input
+	r.Steps.Output = res
+	r.Steps.Signal = res.Signal
+	assert.Nil(t, rr.CreateRun(context.Background(), r))
+	return r
+}
+
+func TestGetApprovals(t *testing.T) {
+	rr := testhelpers.NewMemoryRepo()
+	r := createPendingApproval(t, rr)
+	assert.Nil(t, rr.CreateRun(context.Background(), testhelpers.CreateSampleRun("build", "s1", make(run.InputData))))
+
+	router := rest.NewRouter("test", run.NewJobsStore(testhelpers.CreateStepperStore()), rr, nil, logging.New("test", os.Stderr))
+	req := httptest.NewRequest(http.MethodGet, "/Approvals", nil)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var result []rest.ApprovalRepresentation
+	resultFrom(t, &result, resp.Body)
+	assert.Len(t, result, 1)
+	assert.Equal(t, r.UUID, result[0].RunUUID)
+	assert.Equal(t, r.Steps.UUID, result[0].StepUUID)
+	assert.Equal(t, []string{"jane"}, result[0].Approvers)
+	assert.NotNil(t, result[0].RequestedAt)
+}
+
+func TestDecideApproval(t *testing.T) {
+	tests := map[string]struct {
+		action     string
+		body       string
+		wantStatus int
+		wantState  run.State
+	}{
+		"approved":                {"Approve", `{"approver": "jane", "comment": "lgtm"}`, http.StatusOK, run.StateSuccess},
+		"rejected":                {"Reject", `{"approver": "jane"}`, http.StatusOK, run.StateFailed},
+		"by an unlisted approver": {"Approve", `{"approver": "joe"}`, http.StatusForbidden, ""},
+		"without an approver":     {"Approve", `{}`, http.StatusBadRequest, ""},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			rr := testhelpers.NewMemoryRepo()
+			r := createPendingApproval(t, rr)
+
+			router := rest.NewRouter("test", run.NewJobsStore(testhelpers.CreateStepperStore()), rr, nil, logging.New("test", os.Stderr))
+			url := fmt.Sprintf("/Runs/%s/Steps/%s/%s", r.UUID, r.Steps.UUID, tc.action)
+			req := httptest.NewRequest(http.MethodPost, url, bytes.NewBufferString(tc.body))
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantStatus, resp.Code)
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			var result *rest.RunRepresentation
+			resultFrom(t, &result, resp.Body)
+			assert.Equal(t, tc.wantState, result.Steps.State)
+			assert.Equal(t, "jane", result.Steps.Output.Data.UnmarshalString("approver"))
+
+			// a step can only be decided once.
+			req = httptest.NewRequest(http.MethodPost, url, bytes.NewBufferString(tc.body))
+			resp = httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+			assert.Equal(t, http.StatusConflict, resp.Code)
+		})
+	}
+}
+
+func TestDecideApproval_ApproverHeader(t *testing.T) {
+	tests := map[string]struct {
+		header       string
+		wantStatus   int
+		wantApprover string
+	}{
+		"from the header":         {"jane", http.StatusOK, "jane"},
+		"by an unlisted approver": {"joe", http.StatusForbidden, ""},
+		"without the header":      {"", http.StatusUnauthorized, ""},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			rr := testhelpers.NewMemoryRepo()
+			r := createPendingApproval(t, rr)
+
+			router := rest.NewRouter("test", run.NewJobsStore(testhelpers.CreateStepperStore()), rr, nil, logging.New("test", os.Stderr), rest.WithApproverHeader("X-User"))
+			url := fmt.Sprintf("/Runs/%s/Steps/%s/Approve", r.UUID, r.Steps.UUID)
+			// the approver in the body can't be used to decide for someone else.
+			req := httptest.NewRequest(http.MethodPost, url, bytes.NewBufferString(`{"approver": "jane"}`))
+			if tc.header != "" {
+				req.Header.Set("X-User", tc.header)
+			}
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantStatus, resp.Code)
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			var result *rest.RunRepresentation
+			resultFrom(t, &result, resp.Body)
+			assert.Equal(t, tc.wantApprover, result.Steps.Output.Data.UnmarshalString("approver"))
+		})
+	}
+}
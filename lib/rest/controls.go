@@ -0,0 +1,133 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/mitchfriedman/workflow/lib/control"
+	"github.com/mitchfriedman/workflow/lib/logging"
+	"github.com/mitchfriedman/workflow/lib/tracing"
+)
+
+// ControlRepresentation is a JSON API response of a control that pauses the
+// queues of runs.
+type ControlRepresentation struct {
+	Created        time.Time `json:"created"`
+	Job            string    `json:"job_name"`
+	PausedBy       string    `json:"paused_by"`
+	Reason         string    `json:"reason"`
+	RejectTriggers bool      `json:"reject_triggers"`
+	Scope          string    `json:"scope"`
+}
+
+type controlRequest struct {
+	Job            string `json:"job_name"`
+	PausedBy       string `json:"paused_by"`
+	Reason         string `json:"reason"`
+	RejectTriggers bool   `json:"reject_triggers"`
+	Scope          string `json:"scope"`
+}
+
+func createControlRepresentation(c control.Control) ControlRepresentation {
+	return ControlRepresentation{
+		Created:        c.Created,
+		Job:            c.JobName,
+		PausedBy:       c.PausedBy,
+		Reason:         c.Reason,
+		RejectTriggers: c.RejectTriggers,
+		Scope:          c.Scope,
+	}
+}
+
+// BuildGetControlsHandler builds a HandlerFunc that lists the controls that
+// pause the queues of runs.
+func BuildGetControlsHandler(cr control.Repo, logger logging.StructuredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		span, ctx := tracing.NewServiceSpan(r.Context(), "get_controls")
+		defer span.Finish()
+
+		controls, err := cr.ListControls(ctx)
+		if err != nil {
+			span.RecordError(err)
+			logger.Errorf("failed to list controls: %v", err)
+			respondErr(w, Error(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		reps := make([]ControlRepresentation, len(controls))
+		for i, c := range controls {
+			reps[i] = createControlRepresentation(c)
+		}
+		respond(w, http.StatusOK, reps)
+	}
+}
+
+// BuildPauseControlHandler builds a HandlerFunc that pauses every run of the
+// job and scope in the request body. Without a scope, every scope of the job
+// is paused, and without a job name, every job is.
+func BuildPauseControlHandler(cr control.Repo, logger logging.StructuredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		span, ctx := tracing.NewServiceSpan(r.Context(), "pause_control")
+		defer span.Finish()
+
+		defer r.Body.Close()
+		var req controlRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondErr(w, Error(http.StatusBadRequest, "failed to parse control: "+err.Error()))
+			return
+		}
+		span.SetTag("job_name", req.Job)
+		span.SetTag("scope", req.Scope)
+
+		c := &control.Control{
+			JobName:        req.Job,
+			Scope:          req.Scope,
+			Reason:         req.Reason,
+			PausedBy:       req.PausedBy,
+			RejectTriggers: req.RejectTriggers,
+		}
+		if err := c.Validate(); err != nil {
+			respondErr(w, Error(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		if err := cr.Pause(ctx, c); err != nil {
+			span.RecordError(err)
+			logger.Errorf("failed to pause %s-%s: %v", c.JobName, c.Scope, err)
+			respondErr(w, Error(http.StatusInternalServerError, err.Error()))
+			return
+		}
+
+		respond(w, http.StatusOK, createControlRepresentation(*c))
+	}
+}
+
+// BuildResumeControlHandler builds a HandlerFunc that removes the control of
+// the job and scope in the request body.
+func BuildResumeControlHandler(cr control.Repo, logger logging.StructuredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		span, ctx := tracing.NewServiceSpan(r.Context(), "resume_control")
+		defer span.Finish()
+
+		defer r.Body.Close()
+		var req controlRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondErr(w, Error(http.StatusBadRequest, "failed to parse control: "+err.Error()))
+			return
+		}
+		span.SetTag("job_name", req.Job)
+		span.SetTag("scope", req.Scope)
+
+		switch err := cr.Resume(ctx, req.Job, req.Scope); err {
+		case nil:
+			respond(w, http.StatusOK, m{"job_name": req.Job, "scope": req.Scope, "paused": false})
+		case control.ErrNotFound:
+			respondErr(w, Error(http.StatusNotFound, err.Error()))
+		default:
+			span.RecordError(err)
+			logger.Errorf("failed to resume %s-%s: %v", req.Job, req.Scope, err)
+			respondErr(w, Error(http.StatusInternalServerError, err.Error()))
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mitchfriedman/workflow/lib/logging"
+	"github.com/mitchfriedman/workflow/lib/rest"
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestControls(t *testing.T) {
+	rr := testhelpers.NewMemoryRepo()
+	cr := testhelpers.NewMemoryControlRepo()
+	js := run.NewJobsStore(testhelpers.CreateStepperStore())
+	js.Register(testhelpers.CreateSampleJob("deploy"))
+	parser := &fakeParser{&run.Trigger{JobName: "deploy", Scope: "app"}, nil}
+	router := rest.NewRouter("test", js, rr, []rest.Parser{parser}, logging.New("test", os.Stderr), rest.WithControls(cr))
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post("/Controls/Pause", `{"scope": "app"}`).Code)
+
+	// a paused job still queues its runs by default.
+	assert.Equal(t, http.StatusOK, post("/Controls/Pause", `{"job_name": "deploy", "reason": "incident"}`).Code)
+	assert.Equal(t, http.StatusOK, post("/Triggers", `{}`).Code)
+
+	assert.Equal(t, http.StatusOK, post("/Controls/Pause", `{"job_name": "deploy", "reason": "incident", "reject_triggers": true}`).Code)
+	assert.Equal(t, http.StatusConflict, post("/Triggers", `{}`).Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/Controls", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var controls []rest.ControlRepresentation
+	resultFrom(t, &controls, resp.Body)
+	if assert.Len(t, controls, 1) {
+		assert.Equal(t, "deploy", controls[0].Job)
+		assert.Equal(t, "incident", controls[0].Reason)
+		assert.True(t, controls[0].RejectTriggers)
+	}
+
+	assert.Equal(t, http.StatusOK, post("/Controls/Resume", `{"job_name": "deploy"}`).Code)
+	assert.Equal(t, http.StatusNotFound, post("/Controls/Resume", `{"job_name": "deploy"}`).Code)
+	assert.Equal(t, http.StatusOK, post("/Triggers", `{}`).Code)
+
+	runs, err := rr.ListByJob(context.Background(), "deploy")
+	assert.Nil(t, err)
+	assert.Len(t, runs, 2)
+}
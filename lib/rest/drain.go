@@ -0,0 +1,19 @@
+package rest
+
+import "net/http"
+
+// Drainer is something that can be drained, such as an engine.Engine.
+type Drainer interface {
+	Drain()
+	Draining() bool
+}
+
+// BuildDrainHandler builds a HandlerFunc that drains d, so that it stops
+// claiming new runs and shuts down once its steps have finished. It isn't
+// part of NewRouter, since the router may be served apart from the engine.
+func BuildDrainHandler(d Drainer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d.Drain()
+		respond(w, http.StatusAccepted, m{"draining": d.Draining()})
+	}
+}
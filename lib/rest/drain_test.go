@@ -0,0 +1,32 @@
+package rest_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mitchfriedman/workflow/lib/rest"
+)
+
+type drainer struct {
+	draining bool
+}
+
+func (d *drainer) Drain()         { d.draining = true }
+func (d *drainer) Draining() bool { return d.draining }
+
+func TestDrainHandler(t *testing.T) {
+	d := &drainer{}
+	req := httptest.NewRequest(http.MethodPost, "/Drain", nil)
+	resp := httptest.NewRecorder()
+
+	rest.BuildDrainHandler(d).ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+	assert.True(t, d.draining)
+
+	var result map[string]bool
+	resultFrom(t, &result, resp.Body)
+	assert.True(t, result["draining"])
+}
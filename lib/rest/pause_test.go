@@ -0,0 +1,60 @@
+package rest_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mitchfriedman/workflow/lib/logging"
+	"github.com/mitchfriedman/workflow/lib/rest"
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPauseRun(t *testing.T) {
+	rr := testhelpers.NewMemoryRepo()
+	r := testhelpers.CreateSampleRun("job1", "s1", make(run.InputData))
+	assert.Nil(t, rr.CreateRun(context.Background(), r))
+	router := rest.NewRouter("test", run.NewJobsStore(testhelpers.CreateStepperStore()), rr, nil, logging.New("test", os.Stderr))
+
+	post := func(action string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/Runs/%s/%s", r.UUID, action), nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := post("Pause")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var result *rest.RunRepresentation
+	resultFrom(t, &result, resp.Body)
+	assert.True(t, result.Paused)
+
+	resp = post("Resume")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resultFrom(t, &result, resp.Body)
+	assert.False(t, result.Paused)
+	assert.Len(t, result.History, 2)
+
+	assert.Equal(t, http.StatusConflict, post("Resume").Code)
+
+	// a run that is being executed stays claimed by its worker, which
+	// finishes the step before the run is held.
+	found, err := rr.GetRun(context.Background(), r.UUID)
+	assert.Nil(t, err)
+	assert.Nil(t, rr.ClaimRun(context.Background(), found, "worker-1", time.Minute))
+
+	resp = post("Pause")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resultFrom(t, &result, resp.Body)
+	assert.True(t, result.Paused)
+	if assert.NotNil(t, result.ClaimedBy) {
+		assert.Equal(t, "worker-1", *result.ClaimedBy)
+	}
+}
@@ -0,0 +1,73 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mitchfriedman/workflow/lib/logging"
+	"github.com/mitchfriedman/workflow/lib/rest"
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryRun(t *testing.T) {
+	worker := "worker-1"
+
+	tests := map[string]struct {
+		state      run.State
+		body       string
+		claimed    bool
+		wantStatus int
+	}{
+		"an errored run":                  {run.StateError, "", false, http.StatusOK},
+		"with corrected input":            {run.StateError, `{"input": {"region": "eu-west-1"}, "reset_after": true}`, false, http.StatusOK},
+		"a queued run":                    {run.StateQueued, "", false, http.StatusConflict},
+		"with an invalid body":            {run.StateError, `{"input": 1}`, false, http.StatusBadRequest},
+		"while the run is being executed": {run.StateError, "", true, http.StatusConflict},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			rr := testhelpers.NewMemoryRepo()
+			r := testhelpers.CreateSampleRun("job1", "s1", run.InputData{"region": "us-east-1"})
+			if tc.state == run.StateError {
+				r.Steps.Abort("invalid input")
+			}
+			r.State = tc.state
+			if tc.claimed {
+				r.ClaimedBy = &worker
+			}
+			assert.Nil(t, rr.CreateRun(context.Background(), r))
+
+			router := rest.NewRouter("test", run.NewJobsStore(testhelpers.CreateStepperStore()), rr, nil, logging.New("test", os.Stderr))
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/Runs/%s/Retry", r.UUID), bytes.NewBufferString(tc.body))
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantStatus, resp.Code)
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			var result *rest.RunRepresentation
+			resultFrom(t, &result, resp.Body)
+			assert.Equal(t, run.StateQueued, run.State(result.State))
+			assert.Equal(t, run.StateQueued, result.Steps.State)
+			if assert.Len(t, result.History, 1) {
+				assert.Equal(t, run.EventRetry, result.History[0].Type)
+				assert.Equal(t, run.StateError, result.History[0].State)
+			}
+			if tc.body != "" {
+				assert.Equal(t, "eu-west-1", result.Input.UnmarshalString("region"))
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package rest
 import (
 	"net/http"
 
+	"github.com/mitchfriedman/workflow/lib/control"
 	"github.com/mitchfriedman/workflow/lib/logging"
 
 	"github.com/mitchfriedman/workflow/lib/run"
@@ -16,15 +17,60 @@ type Parser interface {
 	Parse(*http.Request) (*run.Trigger, error)
 }
 
+type routerConfig struct {
+	controls       control.Repo
+	approverHeader string
+}
+
+type RouterOption func(c *routerConfig)
+
+// WithControls registers the routes that pause and resume the queues of runs
+// with cr, and makes triggers check them.
+func WithControls(cr control.Repo) RouterOption {
+	return func(c *routerConfig) {
+		c.controls = cr
+	}
+}
+
+// WithApproverHeader takes the approver of approval decisions from the header
+// with the given name, which the authentication in front of the router sets
+// to the identity of the caller, instead of from the request body. Decisions
+// without the header are rejected.
+func WithApproverHeader(name string) RouterOption {
+	return func(c *routerConfig) {
+		c.approverHeader = name
+	}
+}
+
 // NewRouter creates and returns a configured mux with registered routes.
-func NewRouter(serviceName string, s *run.JobStore, rr run.Repo, p []Parser, logger logging.StructuredLogger) *mux.Router {
+func NewRouter(serviceName string, s *run.JobStore, rr run.Repo, p []Parser, logger logging.StructuredLogger, options ...RouterOption) *mux.Router {
+	var cfg routerConfig
+	for _, opt := range options {
+		opt(&cfg)
+	}
+
 	router := mux.NewRouter(mux.WithServiceName(serviceName))
 	router.HandleFunc("/healthcheck", BuildHealthcheckHandler()).Methods("GET")
 	router.HandleFunc("/Jobs", BuildGetJobsHandler(s)).Methods("GET")
 	router.HandleFunc("/Runs", BuildGetRunsHandler(rr)).Methods("GET")
 	router.HandleFunc("/Runs/{uuid}", BuildGetRunHandler(rr, logger)).Methods("GET")
 	router.HandleFunc("/Runs/{uuid}/Cancel", BuildCancelRunHandler(rr, logger)).Methods("POST")
-	router.HandleFunc("/Triggers", BuildTriggersHandler(s, rr, p, logger)).Methods("POST")
+	router.HandleFunc("/Runs/{uuid}/Pause", BuildPauseRunHandler(rr, logger)).Methods("POST")
+	router.HandleFunc("/Runs/{uuid}/Resume", BuildResumeRunHandler(rr, logger)).Methods("POST")
+	router.HandleFunc("/Runs/{uuid}/Retry", BuildRetryRunHandler(rr, logger)).Methods("POST")
+	router.HandleFunc("/Runs/{uuid}/Signals/{name}", BuildSignalRunHandler(rr, logger)).Methods("POST")
+	router.HandleFunc("/Runs/{uuid}/Steps/{step_uuid}/Approve", BuildDecideHandler(rr, true, cfg.approverHeader, logger)).Methods("POST")
+	router.HandleFunc("/Runs/{uuid}/Steps/{step_uuid}/Reject", BuildDecideHandler(rr, false, cfg.approverHeader, logger)).Methods("POST")
+	router.HandleFunc("/Runs/{uuid}/Steps/{step_uuid}/Skip", BuildOverrideStepHandler(rr, true, logger)).Methods("POST")
+	router.HandleFunc("/Runs/{uuid}/Steps/{step_uuid}/ForceFail", BuildOverrideStepHandler(rr, false, logger)).Methods("POST")
+	router.HandleFunc("/Approvals", BuildGetApprovalsHandler(rr, logger)).Methods("GET")
+	router.HandleFunc("/Triggers", BuildTriggersHandler(s, rr, p, logger, cfg.controls)).Methods("POST")
+
+	if cfg.controls != nil {
+		router.HandleFunc("/Controls", BuildGetControlsHandler(cfg.controls, logger)).Methods("GET")
+		router.HandleFunc("/Controls/Pause", BuildPauseControlHandler(cfg.controls, logger)).Methods("POST")
+		router.HandleFunc("/Controls/Resume", BuildResumeControlHandler(cfg.controls, logger)).Methods("POST")
+	}
 
 	return router
 }
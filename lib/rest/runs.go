@@ -1,7 +1,10 @@
 package rest
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -18,18 +21,34 @@ import (
 
 // RunRepresentation is a JSON API response of a run
 type RunRepresentation struct {
-	ClaimedBy    *string       `json:"claimed_by"`
-	ClaimedUntil *time.Time    `json:"claimed_until"`
-	CurrentStep  string        `json:"current_step"`
-	Finished     *time.Time    `json:"finished"`
-	Input        run.InputData `json:"input"`
-	Job          string        `json:"job"`
-	Rollback     bool          `json:"rollback"`
-	Scope        string        `json:"scope"`
-	Started      time.Time     `json:"started"`
-	State        string        `json:"state"`
-	Steps        *run.Step     `json:"steps"`
-	UUID         string        `json:"uuid"`
+	ClaimedBy     *string                      `json:"claimed_by"`
+	ClaimedUntil  *time.Time                   `json:"claimed_until"`
+	Children      []string                     `json:"children"`
+	Compensations []CompensationRepresentation `json:"compensations"`
+	CurrentStep   string                       `json:"current_step"`
+	Finished      *time.Time                   `json:"finished"`
+	History       []run.Event                  `json:"history"`
+	Input         run.InputData                `json:"input"`
+	Job           string                       `json:"job"`
+	NotBefore     *time.Time                   `json:"not_before"`
+	ParentUUID    *string                      `json:"parent_uuid"`
+	Paused        bool                         `json:"paused"`
+	Rollback      bool                         `json:"rollback"`
+	Scope         string                       `json:"scope"`
+	Started       time.Time                    `json:"started"`
+	State         string                       `json:"state"`
+	Steps         *run.Step                    `json:"steps"`
+	UUID          string                       `json:"uuid"`
+}
+
+// CompensationRepresentation is a JSON API response of the outcome of a step
+// that undoes a completed step of a failed run.
+type CompensationRepresentation struct {
+	Compensates string `json:"compensates"`
+	Error       string `json:"error"`
+	State       string `json:"state"`
+	StepType    string `json:"step_type"`
+	StepUUID    string `json:"step_uuid"`
 }
 
 func createRepresentation(runs []*run.Run) ([]RunRepresentation, error) {
@@ -63,19 +82,36 @@ func createRunRepresentation(r *run.Run) (RunRepresentation, error) {
 		return RunRepresentation{}, errors.Wrap(err, "failed to unmarshal run data")
 	}
 
+	compensations := make([]CompensationRepresentation, 0)
+	for _, c := range r.Compensations() {
+		compensations = append(compensations, CompensationRepresentation{
+			Compensates: c.Compensates,
+			Error:       c.Step.Output.Error,
+			State:       string(c.Step.State),
+			StepType:    c.Step.StepType,
+			StepUUID:    c.Step.UUID,
+		})
+	}
+
 	return RunRepresentation{
-		ClaimedBy:    r.ClaimedBy,
-		ClaimedUntil: r.ClaimedUntil,
-		CurrentStep:  currentStep,
-		Finished:     r.Finished,
-		Input:        r.Input,
-		Job:          r.JobName,
-		Rollback:     r.Rollback,
-		Scope:        r.Scope,
-		Started:      r.Started,
-		State:        string(r.State),
-		UUID:         r.UUID,
-		Steps:        r.Steps,
+		ClaimedBy:     r.ClaimedBy,
+		ClaimedUntil:  r.ClaimedUntil,
+		Children:      r.Children(),
+		Compensations: compensations,
+		CurrentStep:   currentStep,
+		Finished:      r.Finished,
+		History:       r.History,
+		Input:         r.Input,
+		Job:           r.JobName,
+		NotBefore:     r.NotBefore,
+		ParentUUID:    r.ParentUUID,
+		Paused:        r.Paused,
+		Rollback:      r.Rollback,
+		Scope:         r.Scope,
+		Started:       r.Started,
+		State:         string(r.State),
+		UUID:          r.UUID,
+		Steps:         r.Steps,
 	}, nil
 }
 
@@ -87,43 +123,165 @@ func BuildCancelRunHandler(rr run.Repo, logger logging.StructuredLogger) http.Ha
 		defer span.Finish()
 		span.SetTag("uuid", uuid)
 
-		found, err := rr.GetRun(ctx, uuid)
-		if err != nil {
-			switch err {
-			case run.ErrNotFound:
-				respondErr(w, Error(http.StatusNotFound, err.Error()))
+		// a worker executing the run notices the cancellation and cancels the
+		// context of its steps.
+		updateRun(ctx, w, span, rr, logger, uuid, func(r *run.Run) error {
+			switch err := r.Cancel("canceled by user"); err {
+			case nil:
+				return nil
+			case run.ErrNotCancelable:
+				return Error(http.StatusConflict, err.Error())
 			default:
-				span.RecordError(err)
-				logger.Errorf("failed to get run with uuid %s - %v", uuid, err)
-				respondErr(w, Error(http.StatusInternalServerError, err.Error()))
+				return err
 			}
+		})
+	}
+}
+
+type retryRequest struct {
+	Input      run.InputData `json:"input"`
+	ResetAfter bool          `json:"reset_after"`
+}
+
+// BuildRetryRunHandler builds a HandlerFunc that resumes a failed or errored
+// run from the steps that failed. The request body can hold input to merge
+// into the run, and whether to reset the steps after the failed ones too.
+func BuildRetryRunHandler(rr run.Repo, logger logging.StructuredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		uuid := params["uuid"]
+		span, ctx := tracing.NewServiceSpan(r.Context(), "retry_run")
+		defer span.Finish()
+		span.SetTag("uuid", uuid)
+
+		defer r.Body.Close()
+		var req retryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			respondErr(w, Error(http.StatusBadRequest, "failed to parse retry: "+err.Error()))
 			return
 		}
 
-		found.Fail("canceled by user")
-		if err := rr.ReleaseRun(ctx, found); err != nil {
+		opts := run.RetryOptions{Input: req.Input, ResetAfter: req.ResetAfter}
+		updateRun(ctx, w, span, rr, logger, uuid, func(r *run.Run) error {
+			if r.ClaimedBy != nil {
+				return errRunClaimed
+			}
+			switch err := r.Retry(opts, time.Now().UTC()); err {
+			case nil:
+				return nil
+			case run.ErrNotRetryable:
+				return Error(http.StatusConflict, err.Error())
+			default:
+				return err
+			}
+		})
+	}
+}
+
+// BuildPauseRunHandler builds a HandlerFunc that pauses a run so that it isn't
+// claimed again until it's resumed. A step that is executing is allowed to
+// finish, and its worker holds on to the run until then.
+func BuildPauseRunHandler(rr run.Repo, logger logging.StructuredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		uuid := params["uuid"]
+		span, ctx := tracing.NewServiceSpan(r.Context(), "pause_run")
+		defer span.Finish()
+		span.SetTag("uuid", uuid)
+
+		updateRun(ctx, w, span, rr, logger, uuid, func(r *run.Run) error {
+			switch err := r.Pause(time.Now().UTC()); err {
+			case nil:
+				return nil
+			case run.ErrNotPausable:
+				return Error(http.StatusConflict, err.Error())
+			default:
+				return err
+			}
+		})
+	}
+}
+
+// BuildResumeRunHandler builds a HandlerFunc that resumes a paused run.
+func BuildResumeRunHandler(rr run.Repo, logger logging.StructuredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		uuid := params["uuid"]
+		span, ctx := tracing.NewServiceSpan(r.Context(), "resume_run")
+		defer span.Finish()
+		span.SetTag("uuid", uuid)
+
+		updateRun(ctx, w, span, rr, logger, uuid, func(r *run.Run) error {
+			switch err := r.Resume(time.Now().UTC()); err {
+			case nil:
+				return nil
+			case run.ErrNotPaused:
+				return Error(http.StatusConflict, err.Error())
+			default:
+				return err
+			}
+		})
+	}
+}
+
+// errRunClaimed rejects an update of a run that a worker is executing, when the
+// worker could overwrite it with the outcome of its steps, such as timing out
+// a step that is being signalled.
+var errRunClaimed = Error(http.StatusConflict, "run is being executed, try again")
+
+// updateRun applies f to the run with the given uuid and responds with the
+// updated run. f is applied again if the run changes before it's written, and
+// can reject the update by returning an *httpError. The claim of a worker
+// executing the run is kept, so no other worker claims the run until the
+// first one notices the update.
+func updateRun(ctx context.Context, w http.ResponseWriter, span *tracing.Span, rr run.Repo, logger logging.StructuredLogger, uuid string, f func(*run.Run) error) {
+	found, err := rr.GetRun(ctx, uuid)
+	if err != nil {
+		switch err {
+		case run.ErrNotFound:
+			respondErr(w, Error(http.StatusNotFound, err.Error()))
+		default:
 			span.RecordError(err)
-			logger.Errorf("failed to cancel run with uuid %s - %v", uuid, err)
+			logger.Errorf("failed to get run with uuid %s - %v", uuid, err)
 			respondErr(w, Error(http.StatusInternalServerError, err.Error()))
 		}
+		return
+	}
 
-		if err := found.UnmarshalRunData(); err != nil {
-			span.RecordError(err)
-			logger.Errorf("failed to unmarshal run data: %v", found, err)
-			respondErr(w, Error(http.StatusInternalServerError, err.Error()))
+	if err := found.UnmarshalRunData(); err != nil {
+		span.RecordError(err)
+		logger.Errorf("failed to unmarshal run data: %v", found, err)
+		respondErr(w, Error(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	found, err = run.Modify(ctx, rr, found, f)
+	if err != nil {
+		if httpErr, ok := err.(*httpError); ok {
+			respondErr(w, httpErr)
 			return
 		}
 
-		res, err := createRunRepresentation(found)
-		if err != nil {
+		switch err {
+		case run.ErrConflict:
+			respondErr(w, Error(http.StatusConflict, err.Error()))
+		default:
 			span.RecordError(err)
-			logger.Errorf("failed to marshal run %v", found, err)
+			logger.Errorf("failed to update run with uuid %s - %v", uuid, err)
 			respondErr(w, Error(http.StatusInternalServerError, err.Error()))
-			return
 		}
+		return
+	}
 
-		respond(w, http.StatusOK, res)
+	res, err := createRunRepresentation(found)
+	if err != nil {
+		span.RecordError(err)
+		logger.Errorf("failed to marshal run %v", found, err)
+		respondErr(w, Error(http.StatusInternalServerError, err.Error()))
+		return
 	}
+
+	respond(w, http.StatusOK, res)
 }
 
 // BuildGetRunHandler builds a HandlerFunc to get a run by the runs UUID.
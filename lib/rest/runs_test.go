@@ -37,7 +37,7 @@ func TestCancelRun(t *testing.T) {
 		"with no run found": {"other", nil, 404},
 	}
 
-	router := rest.NewRouter("test", run.NewJobsStore(), rr, nil, logging.New("test", os.Stderr))
+	router := rest.NewRouter("test", run.NewJobsStore(testhelpers.CreateStepperStore()), rr, nil, logging.New("test", os.Stderr))
 
 	for name, tc := range tests {
 		tc := tc
@@ -57,6 +57,24 @@ func TestCancelRun(t *testing.T) {
 	}
 }
 
+func TestCancelFinishedRun(t *testing.T) {
+	rr := testhelpers.NewMemoryRepo()
+	r := testhelpers.CreateSampleRunFirst2StepsSuccess("job1", "s1", make(run.InputData))
+	r.State = run.StateSuccess
+	assert.Nil(t, rr.CreateRun(context.Background(), r))
+
+	router := rest.NewRouter("test", run.NewJobsStore(testhelpers.CreateStepperStore()), rr, nil, logging.New("test", os.Stderr))
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/Runs/%s/Cancel", r.UUID), nil)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+
+	found, err := rr.GetRun(context.Background(), r.UUID)
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateSuccess, found.State)
+}
+
 func TestGetRun(t *testing.T) {
 	db, closer := testhelpers.DBConnection(t, false)
 	defer closer()
@@ -74,7 +92,7 @@ func TestGetRun(t *testing.T) {
 		"with no run found": {"other", nil, 404},
 	}
 
-	router := rest.NewRouter("test", run.NewJobsStore(), rr, nil, logging.New("test", os.Stderr))
+	router := rest.NewRouter("test", run.NewJobsStore(testhelpers.CreateStepperStore()), rr, nil, logging.New("test", os.Stderr))
 
 	for name, tc := range tests {
 		tc := tc
@@ -127,7 +145,7 @@ func TestGetRuns(t *testing.T) {
 		"with jobs query not present": {"", "", []*run.Run{}, 400},
 		"with jobs none found":        {"mr shneebly", "", []*run.Run{}, 200},
 	}
-	router := rest.NewRouter("test", run.NewJobsStore(), rr, nil, logging.New("test", os.Stderr))
+	router := rest.NewRouter("test", run.NewJobsStore(testhelpers.CreateStepperStore()), rr, nil, logging.New("test", os.Stderr))
 
 	for name, tc := range tests {
 		tc := tc
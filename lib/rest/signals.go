@@ -0,0 +1,51 @@
+package rest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mitchfriedman/workflow/lib/logging"
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/tracing"
+)
+
+// BuildSignalRunHandler builds a HandlerFunc that delivers a signal to the
+// steps of a run that are waiting for it. The JSON object in the request body,
+// if any, is merged into the output of those steps.
+func BuildSignalRunHandler(rr run.Repo, logger logging.StructuredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		uuid := params["uuid"]
+		name := params["name"]
+		span, ctx := tracing.NewServiceSpan(r.Context(), "signal_run")
+		defer span.Finish()
+		span.SetTag("uuid", uuid)
+		span.SetTag("signal", name)
+
+		defer r.Body.Close()
+		payload := make(run.InputData)
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && err != io.EOF {
+			respondErr(w, Error(http.StatusBadRequest, "failed to parse signal payload: "+err.Error()))
+			return
+		}
+
+		updateRun(ctx, w, span, rr, logger, uuid, func(r *run.Run) error {
+			if r.ClaimedBy != nil {
+				return errRunClaimed
+			}
+
+			switch err := r.Signal(name, payload, time.Now().UTC()); err {
+			case nil:
+				return nil
+			case run.ErrNoSignalWaiter:
+				return Error(http.StatusConflict, err.Error())
+			default:
+				return err
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mitchfriedman/workflow/lib/logging"
+	"github.com/mitchfriedman/workflow/lib/rest"
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignalRun(t *testing.T) {
+	worker := "worker-1"
+
+	tests := map[string]struct {
+		signal     string
+		body       string
+		claimed    bool
+		wantStatus int
+	}{
+		"with the awaited signal":         {"approved", `{"approver": "jane"}`, false, http.StatusOK},
+		"without a payload":               {"approved", "", false, http.StatusOK},
+		"with another signal":             {"rejected", "", false, http.StatusConflict},
+		"with an invalid payload":         {"approved", `[1, 2]`, false, http.StatusBadRequest},
+		"while the run is being executed": {"approved", "", true, http.StatusConflict},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			rr := testhelpers.NewMemoryRepo()
+			r := testhelpers.CreateSampleRun("job1", "s1", make(run.InputData))
+			r.Steps.Signal = "approved"
+			if tc.claimed {
+				r.ClaimedBy = &worker
+			}
+			assert.Nil(t, rr.CreateRun(context.Background(), r))
+
+			router := rest.NewRouter("test", run.NewJobsStore(testhelpers.CreateStepperStore()), rr, nil, logging.New("test", os.Stderr))
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/Runs/%s/Signals/%s", r.UUID, tc.signal), bytes.NewBufferString(tc.body))
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantStatus, resp.Code)
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			var result *rest.RunRepresentation
+			resultFrom(t, &result, resp.Body)
+			assert.Equal(t, run.StateSuccess, result.Steps.State)
+			if tc.body != "" {
+				assert.Equal(t, "jane", result.Steps.Output.Data.UnmarshalString("approver"))
+			}
+		})
+	}
+
+	t.Run("with no run found", func(t *testing.T) {
+		router := rest.NewRouter("test", run.NewJobsStore(testhelpers.CreateStepperStore()), testhelpers.NewMemoryRepo(), nil, logging.New("test", os.Stderr))
+		req := httptest.NewRequest(http.MethodPost, "/Runs/other/Signals/approved", nil)
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+}
@@ -0,0 +1,63 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mitchfriedman/workflow/lib/logging"
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/tracing"
+)
+
+type overrideRequest struct {
+	Output run.InputData `json:"output"`
+	Reason string        `json:"reason"`
+}
+
+// BuildOverrideStepHandler builds a HandlerFunc that skips, or force fails, a
+// step the run is waiting on, such as one that is stuck on an external
+// dependency. The step completes with the output in the request body and the
+// run carries on from it. A worker executing the step notices and cancels it.
+func BuildOverrideStepHandler(rr run.Repo, skip bool, logger logging.StructuredLogger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		uuid := params["uuid"]
+		stepUUID := params["step_uuid"]
+		span, ctx := tracing.NewServiceSpan(r.Context(), "override_step")
+		defer span.Finish()
+		span.SetTag("uuid", uuid)
+		span.SetTag("step_uuid", stepUUID)
+		span.SetTag("skip", skip)
+
+		defer r.Body.Close()
+		var req overrideRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondErr(w, Error(http.StatusBadRequest, "failed to parse override: "+err.Error()))
+			return
+		}
+		if req.Reason == "" {
+			respondErr(w, Error(http.StatusBadRequest, "missing required field: 'reason'"))
+			return
+		}
+
+		override := (*run.Run).ForceFail
+		if skip {
+			override = (*run.Run).Skip
+		}
+		updateRun(ctx, w, span, rr, logger, uuid, func(r *run.Run) error {
+			switch err := override(r, stepUUID, req.Output, req.Reason, time.Now().UTC()); err {
+			case nil:
+				return nil
+			case run.ErrStepNotFound:
+				return Error(http.StatusNotFound, err.Error())
+			case run.ErrStepNotOverridable:
+				return Error(http.StatusConflict, err.Error())
+			default:
+				return err
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package rest_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mitchfriedman/workflow/lib/logging"
+	"github.com/mitchfriedman/workflow/lib/rest"
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverrideStep(t *testing.T) {
+	tests := map[string]struct {
+		action     string
+		step       func(r *run.Run) string
+		body       string
+		wantStatus int
+		wantState  run.State
+	}{
+		"skipping the current step": {
+			"Skip", currentStep, `{"output": {"greeting": "hi"}, "reason": "stuck"}`, http.StatusOK, run.StateSuccess,
+		},
+		"failing the current step": {
+			"ForceFail", currentStep, `{"reason": "host is gone"}`, http.StatusOK, run.StateFailed,
+		},
+		"without a reason": {
+			"Skip", currentStep, `{"output": {"greeting": "hi"}}`, http.StatusBadRequest, "",
+		},
+		"with an invalid body": {
+			"Skip", currentStep, `[1, 2]`, http.StatusBadRequest, "",
+		},
+		"a step the run isn't on": {
+			"Skip", func(r *run.Run) string { return r.Steps.OnSuccess.UUID }, `{"reason": "stuck"}`, http.StatusConflict, "",
+		},
+		"a missing step": {
+			"ForceFail", func(r *run.Run) string { return "missing" }, `{"reason": "stuck"}`, http.StatusNotFound, "",
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			rr := testhelpers.NewMemoryRepo()
+			r := testhelpers.CreateSampleRun("job1", "s1", make(run.InputData))
+			assert.Nil(t, rr.CreateRun(context.Background(), r))
+
+			router := rest.NewRouter("test", run.NewJobsStore(testhelpers.CreateStepperStore()), rr, nil, logging.New("test", os.Stderr))
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/Runs/%s/Steps/%s/%s", r.UUID, tc.step(r), tc.action), bytes.NewBufferString(tc.body))
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantStatus, resp.Code)
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			var result *rest.RunRepresentation
+			resultFrom(t, &result, resp.Body)
+			assert.Equal(t, tc.wantState, result.Steps.State)
+			assert.Len(t, result.History, 1)
+			assert.NotEmpty(t, result.History[0].Reason)
+		})
+	}
+}
+
+func currentStep(r *run.Run) string {
+	return r.Steps.UUID
+}
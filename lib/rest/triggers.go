@@ -2,8 +2,11 @@ package rest
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
+	"github.com/mitchfriedman/workflow/lib/control"
+
 	"github.com/mitchfriedman/workflow/lib/tracing"
 
 	"github.com/mitchfriedman/workflow/lib/logging"
@@ -26,7 +29,10 @@ func parse(parsers []Parser, req *http.Request) (*run.Trigger, error) {
 	return nil, nil
 }
 
-func BuildTriggersHandler(s *run.JobStore, rr run.Repo, p []Parser, logger logging.StructuredLogger) http.HandlerFunc {
+// BuildTriggersHandler builds a HandlerFunc that creates a run for the trigger
+// parsed from the request. When cr is set, the trigger is rejected if a
+// control that rejects triggers pauses the job.
+func BuildTriggersHandler(s *run.JobStore, rr run.Repo, p []Parser, logger logging.StructuredLogger, cr control.Repo) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		ctx := req.Context()
 		span, ctx := tracing.NewServiceSpan(ctx, "triggers")
@@ -56,6 +62,23 @@ func BuildTriggersHandler(s *run.JobStore, rr run.Repo, p []Parser, logger loggi
 			return
 		}
 
+		if cr != nil {
+			controls, err := cr.ListControls(ctx)
+			if err != nil {
+				span.RecordError(err)
+				logger.Errorf("failed to list controls: %v", err)
+				respondErr(w, err)
+				return
+			}
+
+			for _, c := range control.Matching(controls, j.Name, trig.Scope) {
+				if c.RejectTriggers {
+					respondErr(w, Error(http.StatusConflict, fmt.Sprintf("job %s is paused: %s", j.Name, c.Reason)))
+					return
+				}
+			}
+		}
+
 		r := run.NewRun(j, *trig)
 		if err = rr.CreateRun(context.TODO(), r); err != nil {
 			span.RecordError(err)
@@ -35,14 +35,14 @@ func TestTriggers(t *testing.T) {
 	rr := run.NewDatabaseStorage(db)
 	jobName := "job1"
 	r1 := testhelpers.CreateSampleRun(jobName, "s1", make(run.InputData))
-	js := run.NewJobsStore()
+	js := run.NewJobsStore(testhelpers.CreateStepperStore())
 	js.Register(run.NewJob(jobName, r1.Steps))
 
 	parser1 := &fakeParser{nil, nil}
 	parser2 := &fakeParser{nil, errors.New("bad")}
 	parser3 := &fakeParser{&run.Trigger{JobName: jobName}, nil}
 
-	//router := rest.NewRouter("test", run.NewJobsStore(), ni, nil)
+	//router := rest.NewRouter("test", run.NewJobsStore(testhelpers.CreateStepperStore()), ni, nil)
 	tests := map[string]struct {
 		parsers    []rest.Parser
 		wantStatus int
@@ -3,6 +3,7 @@ package webhook
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/mitchfriedman/workflow/lib/run"
 	"github.com/pkg/errors"
@@ -14,6 +15,10 @@ type localWebhook struct {
 	JobName string                 `json:"job_name"`
 	Scope   string                 `json:"scope"`
 	Input   map[string]interface{} `json:"input_data"`
+	RunAt   *time.Time             `json:"run_at"`
+	// Delay is a duration string, such as "24h". A bare number isn't
+	// accepted, since it's ambiguous whether it is in seconds or nanoseconds.
+	Delay string `json:"delay"`
 }
 
 func (*LocalParser) Parse(r *http.Request) (*run.Trigger, error) {
@@ -23,6 +28,13 @@ func (*LocalParser) Parse(r *http.Request) (*run.Trigger, error) {
 		return nil, errors.Wrapf(err, "failed to Parse request body")
 	}
 
+	var delay time.Duration
+	if payload.Delay != "" {
+		if delay, err = time.ParseDuration(payload.Delay); err != nil {
+			return nil, errors.Wrapf(err, "invalid delay %q", payload.Delay)
+		}
+	}
+
 	if payload.Input == nil {
 		payload.Input = make(map[string]interface{})
 	}
@@ -31,5 +43,7 @@ func (*LocalParser) Parse(r *http.Request) (*run.Trigger, error) {
 		JobName: payload.JobName,
 		Scope:   payload.Scope,
 		Input:   payload.Input,
+		RunAt:   payload.RunAt,
+		Delay:   delay,
 	}, nil
 }
@@ -0,0 +1,42 @@
+package webhook_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mitchfriedman/workflow/lib/rest/webhook"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalParser_Delay(t *testing.T) {
+	tests := map[string]struct {
+		body      string
+		wantDelay time.Duration
+		wantErr   bool
+	}{
+		"without a delay":        {`{"job_name": "cleanup"}`, 0, false},
+		"with a duration string": {`{"job_name": "cleanup", "delay": "24h"}`, 24 * time.Hour, false},
+		"with a number":          {`{"job_name": "cleanup", "delay": 60}`, 0, true},
+		"with an invalid string": {`{"job_name": "cleanup", "delay": "soon"}`, 0, true},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/Triggers", bytes.NewBufferString(tc.body))
+			trig, err := (&webhook.LocalParser{}).Parse(req)
+			if tc.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, "cleanup", trig.JobName)
+			assert.Equal(t, tc.wantDelay, trig.Delay)
+		})
+	}
+}
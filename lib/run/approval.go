@@ -0,0 +1,173 @@
+package run
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ApprovalStepperType is the step type of the ApprovalStepper.
+const ApprovalStepperType = "approval"
+
+// approvalSignal is the signal approval steps wait for. It can only be
+// delivered with Run.Decide, so that the approver is checked and recorded.
+const approvalSignal = "approval"
+
+const (
+	approversKey       = "approvers"
+	approvalTimeoutKey = "approval_timeout"
+	requestedAtKey     = "requested_at"
+	approverKey        = "approver"
+	approvedKey        = "approved"
+	commentKey         = "comment"
+	decidedAtKey       = "decided_at"
+)
+
+var ErrNoPendingApproval = errors.New("step is not waiting for an approval")
+var ErrNotApprover = errors.New("approver is not allowed to approve the step")
+
+// Decision is the approval or rejection of an approval step.
+type Decision struct {
+	Approver string
+	Approved bool
+	Comment  string
+	Decided  time.Time
+}
+
+// Approval is a step that is waiting for a decision.
+type Approval struct {
+	RunUUID     string
+	JobName     string
+	Scope       string
+	Step        *Step
+	Approvers   []string // anyone can decide when empty.
+	RequestedAt *time.Time
+	Deadline    *time.Time
+}
+
+// PendingApprovals returns the approval steps of the run that are waiting for
+// a decision.
+func (r *Run) PendingApprovals() []Approval {
+	var pending []Approval
+	for _, s := range r.CurrentSteps() {
+		if s.State != StateQueued || s.Signal != approvalSignal {
+			continue
+		}
+
+		a := Approval{
+			RunUUID:   r.UUID,
+			JobName:   r.JobName,
+			Scope:     r.Scope,
+			Step:      s,
+			Approvers: s.Input.UnmarshalSliceString(approversKey),
+			Deadline:  s.NotBefore,
+		}
+		if at, err := time.Parse(time.RFC3339, s.Output.Data.UnmarshalString(requestedAtKey)); err == nil {
+			a.RequestedAt = &at
+		}
+		pending = append(pending, a)
+	}
+	return pending
+}
+
+// Decide records the decision on the approval step with the given uuid. The
+// step succeeds when it's approved and fails when it's rejected, so that its
+// OnFailure step is executed. The decision is recorded in the output of the
+// step.
+func (r *Run) Decide(stepUUID string, d Decision) error {
+	var step *Step
+	for _, a := range r.PendingApprovals() {
+		if a.Step.UUID != stepUUID {
+			continue
+		}
+		if !allowed(a.Approvers, d.Approver) {
+			return ErrNotApprover
+		}
+		step = a.Step
+	}
+	if step == nil {
+		return ErrNoPendingApproval
+	}
+
+	decided := d.Decided.UTC()
+	data := step.Output.Data.Merge(InputData{
+		approverKey:  d.Approver,
+		approvedKey:  d.Approved,
+		commentKey:   d.Comment,
+		decidedAtKey: decided.Format(time.RFC3339),
+	})
+
+	step.Signal = ""
+	step.NotBefore = nil
+	if d.Approved {
+		step.State = StateSuccess
+		step.Output = Result{State: StateSuccess, Data: data}
+	} else {
+		m := fmt.Sprintf("rejected by %s", d.Approver)
+		data[failureMessage] = m
+		step.State = StateFailed
+		step.Output = Result{State: StateFailed, Data: data, Error: m}
+	}
+
+	r.LastStepComplete = &decided
+	r.Resolve()
+	return nil
+}
+
+func allowed(approvers []string, approver string) bool {
+	if approver == "" {
+		return false
+	}
+	if len(approvers) == 0 {
+		return true
+	}
+	for _, a := range approvers {
+		if a == approver {
+			return true
+		}
+	}
+	return false
+}
+
+// ApprovalStepper is a Stepper that waits for an approval through Run.Decide,
+// such as the sign-off of a production deploy. Only the approvers in its
+// input can decide, or anyone when they aren't provided. The step fails if
+// the optional approval_timeout passes first.
+type ApprovalStepper struct{}
+
+func NewApprovalStepper() *ApprovalStepper {
+	return &ApprovalStepper{}
+}
+
+func (s *ApprovalStepper) Type() string {
+	return ApprovalStepperType
+}
+
+func (s *ApprovalStepper) RequiredInput() []Input {
+	return []Input{
+		{Name: approversKey, Type: ListOf(InputTypeString), Optional: true},
+		{Name: approvalTimeoutKey, Type: InputTypeDuration, Optional: true},
+	}
+}
+
+func (s *ApprovalStepper) Step(d InputData) (Result, error) {
+	// the step is only executed again once its timeout has passed.
+	stepUUID := d.UnmarshalString("step_uuid")
+	if d.UnmarshalString(awaitingStepKey) == stepUUID {
+		m := "timed out waiting for approval"
+		return Result{State: StateFailed, Data: InputData{failureMessage: m}, Error: m}, nil
+	}
+
+	now := time.Now().UTC()
+	var deadline *time.Time
+	if timeout := toDuration(d[approvalTimeoutKey]); timeout > 0 {
+		at := now.Add(timeout)
+		deadline = &at
+	}
+
+	return AwaitSignal(approvalSignal, deadline, InputData{
+		awaitingStepKey: stepUUID,
+		requestedAtKey:  now.Format(time.RFC3339),
+	}), nil
+}
@@ -0,0 +1,91 @@
+package run_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pendingApprovalRun creates a run whose first step is an approval step that
+// is waiting for a decision from one of approvers.
+func pendingApprovalRun(t *testing.T, approvers ...string) *run.Run {
+	t.Helper()
+	r := testhelpers.CreateSampleRun("deploy", "production", nil)
+
+	input := run.InputData{"step_uuid": r.Steps.UUID}
+	if len(approvers) > 0 {
+		input["approvers"] = approvers
+	}
+	res, err := run.NewApprovalStepper().Step(input)
+	assert.Nil(t, err)
+
+	r.Steps.Input = input
+	r.Steps.Output = res
+	r.Steps.Signal = res.Signal
+	return r
+}
+
+func TestRun_Decide(t *testing.T) {
+	now := time.Now().UTC()
+
+	tests := map[string]struct {
+		approvers     []string
+		stepUUID      string
+		decision      run.Decision
+		wantErr       error
+		wantStepState run.State
+	}{
+		"approved":                {[]string{"jane"}, "", run.Decision{Approver: "jane", Approved: true, Comment: "lgtm", Decided: now}, nil, run.StateSuccess},
+		"rejected":                {[]string{"jane"}, "", run.Decision{Approver: "jane", Comment: "not now", Decided: now}, nil, run.StateFailed},
+		"approved by anyone":      {nil, "", run.Decision{Approver: "joe", Approved: true, Decided: now}, nil, run.StateSuccess},
+		"by an unlisted approver": {[]string{"jane"}, "", run.Decision{Approver: "joe", Approved: true, Decided: now}, run.ErrNotApprover, run.StateQueued},
+		"without an approver":     {nil, "", run.Decision{Approved: true, Decided: now}, run.ErrNotApprover, run.StateQueued},
+		"of another step":         {nil, "ST-other", run.Decision{Approver: "joe", Approved: true, Decided: now}, run.ErrNoPendingApproval, run.StateQueued},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := pendingApprovalRun(t, tc.approvers...)
+			stepUUID := tc.stepUUID
+			if stepUUID == "" {
+				stepUUID = r.Steps.UUID
+			}
+
+			assert.Equal(t, tc.wantErr, r.Decide(stepUUID, tc.decision))
+			assert.Equal(t, tc.wantStepState, r.Steps.State)
+			if tc.wantErr != nil {
+				assert.Len(t, r.PendingApprovals(), 1)
+				return
+			}
+
+			out := r.Steps.Output.Data
+			assert.Equal(t, tc.decision.Approver, out.UnmarshalString("approver"))
+			assert.Equal(t, tc.decision.Approved, out["approved"])
+			assert.Equal(t, tc.decision.Comment, out.UnmarshalString("comment"))
+			assert.Equal(t, now.Format(time.RFC3339), out.UnmarshalString("decided_at"))
+			assert.NotEmpty(t, out.UnmarshalString("requested_at"))
+			assert.Empty(t, r.PendingApprovals())
+			assert.Equal(t, run.StateQueued, r.State)
+		})
+	}
+}
+
+func TestRun_PendingApprovals(t *testing.T) {
+	r := pendingApprovalRun(t, "jane", "joe")
+
+	pending := r.PendingApprovals()
+	assert.Len(t, pending, 1)
+	assert.Equal(t, r.UUID, pending[0].RunUUID)
+	assert.Equal(t, r.Steps, pending[0].Step)
+	assert.Equal(t, []string{"jane", "joe"}, pending[0].Approvers)
+	assert.WithinDuration(t, time.Now(), *pending[0].RequestedAt, time.Minute)
+	assert.Nil(t, pending[0].Deadline)
+
+	// approvals can't be delivered as a plain signal.
+	assert.Equal(t, run.ErrNoSignalWaiter, r.Signal("approval", nil, time.Now()))
+}
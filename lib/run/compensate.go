@@ -0,0 +1,144 @@
+package run
+
+// Compensation is the outcome of a step that undoes a completed step of a run
+// that failed.
+type Compensation struct {
+	Step        *Step
+	Compensates string // uuid of the step that is undone.
+}
+
+// Resolve compensates the run if it failed and resolves its state. See
+// ResolveState.
+func (r *Run) Resolve() {
+	r.compensate()
+	r.State, r.Rollback = r.ResolveState()
+}
+
+// Compensations returns the compensating steps of the run, in the order they
+// are executed.
+func (r *Run) Compensations() []Compensation {
+	var compensations []Compensation
+	var walk func(s *Step)
+	walk = func(s *Step) {
+		if s == nil {
+			return
+		}
+		if s.Compensates != "" {
+			compensations = append(compensations, Compensation{Step: s, Compensates: s.Compensates})
+		}
+		_, next := edges(s)
+		for _, n := range next {
+			walk(n)
+		}
+	}
+	walk(r.Steps)
+	return compensations
+}
+
+// compensate walks the forward path of the run and, when a step failed or
+// errored without an OnFailure step to handle it, executes the compensation of
+// every step that completed before it in reverse order. The compensations are
+// chained as the OnFailure of the step, so the run rolls back through them. A
+// compensation that fails doesn't stop the ones after it. The run fails once
+// they have all succeeded and errors if any of them failed.
+func (r *Run) compensate() {
+	compensateFrom(r.Steps, nil)
+
+	// the rest of the chain is moved to the OnFailure of a compensation that
+	// failed, so that the run carries on rolling back through it.
+	walkSteps(r.Steps, func(s *Step) {
+		if s.Compensates != "" && (s.State == StateFailed || s.State == StateError) && s.OnFailure == nil {
+			s.OnFailure, s.OnSuccess = s.OnSuccess, nil
+		}
+	})
+}
+
+// compensating reports whether the run rolls back from s, which failed or
+// errored, through compensations chained as its OnFailure.
+func compensating(s *Step) bool {
+	return s.OnFailure != nil && s.OnFailure.Compensates != ""
+}
+
+// compensationFailed reports whether any of the compensations of the run
+// didn't succeed.
+func (r *Run) compensationFailed() bool {
+	for _, c := range r.Compensations() {
+		if c.Step.State == StateFailed || c.Step.State == StateError {
+			return true
+		}
+	}
+	return false
+}
+
+func compensateFrom(s *Step, completed []*Step) {
+	if s == nil || s.Compensates != "" {
+		return
+	}
+
+	switch s.State {
+	case StateSuccess:
+		completed = append(completed[:len(completed):len(completed)], s)
+		if len(s.Branches) == 0 {
+			compensateFrom(s.Successor(), completed)
+			return
+		}
+
+		// the branches are undone before the step that fanned out to them.
+		for _, b := range s.Branches {
+			completed = append(completed, completedSteps(b)...)
+		}
+		switch state, _ := resolveBranches(s, nil); state {
+		case StateSuccess:
+			compensateFrom(s.Successor(), completed)
+		case StateFailed:
+			if s.OnFailure == nil {
+				s.OnFailure = compensationChain(completed)
+			}
+		}
+	case StateFailed, StateError:
+		if s.OnFailure == nil {
+			s.OnFailure = compensationChain(completed)
+		}
+	}
+}
+
+// completedSteps returns the steps that succeeded along the forward path
+// starting at s, in the order they were executed.
+func completedSteps(s *Step) []*Step {
+	if s == nil || s.State != StateSuccess {
+		return nil
+	}
+
+	completed := []*Step{s}
+	for _, b := range s.Branches {
+		completed = append(completed, completedSteps(b)...)
+	}
+	return append(completed, completedSteps(s.Successor())...)
+}
+
+// compensationChain creates the compensating steps of the completed steps that
+// declare one, linked in reverse order. It returns nil if there is nothing to
+// compensate.
+func compensationChain(completed []*Step) *Step {
+	var first, last *Step
+	for i := len(completed) - 1; i >= 0; i-- {
+		s := completed[i]
+		if s.Compensate == "" {
+			continue
+		}
+
+		c := stepFactory(&Step{StepType: s.Compensate})
+		c.Input = s.Input.Merge(s.Output.Data).Merge(InputData{compensatedStepKey: s.UUID})
+		c.Compensates = s.UUID
+
+		if first == nil {
+			first = c
+		} else {
+			last.OnSuccess = c
+		}
+		last = c
+	}
+	return first
+}
+
+const compensatedStepKey = "compensated_step_uuid"
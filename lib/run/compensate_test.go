@@ -0,0 +1,129 @@
+package run_test
+
+import (
+	"testing"
+
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createSagaRun creates a run that reserves stock, charges a card and then
+// ships the order. Reserving and charging declare their compensations.
+func createSagaRun() *run.Run {
+	reserve := testhelpers.CreateStep("reserve")
+	reserve.Compensate = "unreserve"
+	reserve.OnSuccess = testhelpers.CreateStep("charge")
+	reserve.OnSuccess.Compensate = "refund"
+	reserve.OnSuccess.OnSuccess = testhelpers.CreateStep("ship")
+
+	return run.NewRun(run.NewJob("order", reserve), run.Trigger{JobName: "order", Scope: "s1"})
+}
+
+func complete(s *run.Step, state run.State, data run.InputData) {
+	s.State = state
+	s.Output = run.Result{State: state, Data: data}
+}
+
+func TestRun_Compensate(t *testing.T) {
+	tests := map[string]struct {
+		compensationStates []run.State
+		wantState          run.State
+	}{
+		"compensations succeed":     {[]run.State{run.StateSuccess, run.StateSuccess}, run.StateFailed},
+		"a compensation fails":      {[]run.State{run.StateFailed, run.StateSuccess}, run.StateError},
+		"a compensation errors":     {[]run.State{run.StateError, run.StateSuccess}, run.StateError},
+		"the last compensation too": {[]run.State{run.StateFailed, run.StateFailed}, run.StateError},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := createSagaRun()
+			reserve, charge := r.Steps, r.Steps.OnSuccess
+			complete(reserve, run.StateSuccess, run.InputData{"reservation": "R-1"})
+			complete(charge, run.StateSuccess, run.InputData{"charge": "C-1"})
+			complete(charge.OnSuccess, run.StateFailed, nil)
+			r.Resolve()
+
+			assert.Equal(t, run.StateQueued, r.State)
+			assert.True(t, r.Rollback)
+
+			// the completed steps are undone in reverse order.
+			compensations := r.Compensations()
+			if assert.Len(t, compensations, 2) {
+				assert.Equal(t, "refund", compensations[0].Step.StepType)
+				assert.Equal(t, charge.UUID, compensations[0].Compensates)
+				assert.Equal(t, "unreserve", compensations[1].Step.StepType)
+				assert.Equal(t, reserve.UUID, compensations[1].Compensates)
+			}
+
+			for _, state := range tc.compensationStates {
+				next, input, err := r.NextStep()
+				assert.Nil(t, err)
+				complete(next, state, nil)
+				r.Resolve()
+
+				if next.Compensates == charge.UUID {
+					assert.Equal(t, "C-1", input.UnmarshalString("charge"))
+					assert.Equal(t, charge.UUID, input.UnmarshalString("compensated_step_uuid"))
+				}
+			}
+
+			// every compensation is executed, even after one fails.
+			assert.Equal(t, tc.wantState, r.State)
+			compensations = r.Compensations()
+			if assert.Len(t, compensations, 2) {
+				for i, c := range compensations {
+					assert.Equal(t, tc.compensationStates[i], c.Step.State)
+				}
+			}
+		})
+	}
+}
+
+func TestRun_Compensate_ErroredStep(t *testing.T) {
+	r := createSagaRun()
+	reserve, charge := r.Steps, r.Steps.OnSuccess
+	complete(reserve, run.StateSuccess, nil)
+	complete(charge, run.StateSuccess, nil)
+	// the step ran out of attempts.
+	complete(charge.OnSuccess, run.StateError, nil)
+	r.Resolve()
+
+	assert.Equal(t, run.StateQueued, r.State)
+	assert.True(t, r.Rollback)
+	assert.Equal(t, "refund", r.CurrentStep().StepType)
+
+	for range r.Compensations() {
+		next, _, err := r.NextStep()
+		assert.Nil(t, err)
+		complete(next, run.StateSuccess, nil)
+		r.Resolve()
+	}
+
+	assert.Equal(t, run.StateFailed, r.State)
+	assert.Equal(t, run.StateError, charge.OnSuccess.State)
+}
+
+func TestRun_Compensate_HandledFailure(t *testing.T) {
+	r := createSagaRun()
+	complete(r.Steps, run.StateSuccess, nil)
+	r.Steps.OnSuccess.OnFailure = testhelpers.CreateStep("notify")
+	complete(r.Steps.OnSuccess, run.StateFailed, nil)
+	r.Resolve()
+
+	// the job handles the failure itself.
+	assert.Empty(t, r.Compensations())
+	assert.Equal(t, "notify", r.CurrentStep().StepType)
+}
+
+func TestRun_Compensate_NothingToUndo(t *testing.T) {
+	r := createSagaRun()
+	complete(r.Steps, run.StateFailed, nil)
+	r.Resolve()
+
+	assert.Empty(t, r.Compensations())
+	assert.Equal(t, run.StateError, r.State)
+}
@@ -0,0 +1,29 @@
+package run
+
+import "context"
+
+type contextKey string
+
+const (
+	runUUIDContextKey  contextKey = "run_uuid"
+	stepUUIDContextKey contextKey = "step_uuid"
+)
+
+// NewStepContext returns a context carrying the uuids of the run and the step
+// being executed.
+func NewStepContext(ctx context.Context, runUUID, stepUUID string) context.Context {
+	ctx = context.WithValue(ctx, runUUIDContextKey, runUUID)
+	return context.WithValue(ctx, stepUUIDContextKey, stepUUID)
+}
+
+// RunUUIDFromContext returns the uuid of the run being executed, if any.
+func RunUUIDFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(runUUIDContextKey).(string)
+	return v
+}
+
+// StepUUIDFromContext returns the uuid of the step being executed, if any.
+func StepUUIDFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(stepUUIDContextKey).(string)
+	return v
+}
@@ -0,0 +1,39 @@
+package run
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Duration is a time.Duration that is marshalled to JSON as a human readable
+// string, such as "1m30s", so it can be declared on step templates.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON accepts either a duration string or a number of nanoseconds.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	switch val := v.(type) {
+	case float64:
+		*d = Duration(time.Duration(val))
+		return nil
+	case string:
+		parsed, err := time.ParseDuration(val)
+		if err != nil {
+			return errors.Wrapf(err, "invalid duration %q", val)
+		}
+		*d = Duration(parsed)
+		return nil
+	default:
+		return errors.Errorf("invalid duration %v", v)
+	}
+}
@@ -0,0 +1,27 @@
+package run
+
+import (
+	"time"
+)
+
+// The types of the events recorded in the history of a run.
+const (
+	EventRetry     = "retry"
+	EventPause     = "pause"
+	EventResume    = "resume"
+	EventSkip      = "skip"
+	EventForceFail = "force_fail"
+)
+
+// Event is an entry of the history of a run. It records a change made to the
+// run from outside of its steps, such as through the API.
+type Event struct {
+	Type  string    `json:"type"`
+	Time  time.Time `json:"time"`
+	State State     `json:"state"` // the state of the run before the change.
+	Steps []string  `json:"steps,omitempty"`
+	Input InputData `json:"input,omitempty"`
+
+	// Reason is why the change was made, as given by the operator.
+	Reason string `json:"reason,omitempty"`
+}
@@ -0,0 +1,239 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrMissingRequiredInput = errors.New("required input is missing")
+var ErrInvalidInput = errors.New("input has an invalid type")
+
+// InputProblem is a single input that failed validation.
+type InputProblem struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+
+	// Err is ErrMissingRequiredInput or ErrInvalidInput.
+	Err error `json:"-"`
+}
+
+// InputError lists every input that failed validation.
+type InputError struct {
+	Problems []InputProblem
+}
+
+func (e *InputError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		problems[i] = fmt.Sprintf("%s: %s", p.Name, p.Message)
+	}
+	return fmt.Sprintf("invalid input: %s", strings.Join(problems, "; "))
+}
+
+// Cause returns ErrMissingRequiredInput when any required input is missing
+// and ErrInvalidInput otherwise, so callers can use errors.Cause.
+func (e *InputError) Cause() error {
+	for _, p := range e.Problems {
+		if p.Err == ErrMissingRequiredInput {
+			return ErrMissingRequiredInput
+		}
+	}
+	return ErrInvalidInput
+}
+
+// ValidateInput checks that data holds every required input with the
+// correct type. It returns a copy of data where missing optional inputs are
+// given their default and numbers given as strings, such as the input of a
+// trigger over HTTP, are converted, or an InputError listing every problem
+// found.
+func ValidateInput(data InputData, requiredInput []Input) (InputData, error) {
+	result := data.Merge(nil)
+	var problems []InputProblem
+
+	for _, ri := range requiredInput {
+		val, ok := data[ri.Name]
+		if !ok || val == nil {
+			switch {
+			case ri.Optional && ri.Default != nil:
+				result[ri.Name] = ri.Default
+			case !ri.Optional:
+				problems = append(problems, InputProblem{
+					Name:    ri.Name,
+					Message: ErrMissingRequiredInput.Error(),
+					Err:     ErrMissingRequiredInput,
+				})
+			}
+			continue
+		}
+
+		coerced, err := checkInputType(val, ri.Type)
+		if err != nil {
+			problems = append(problems, InputProblem{Name: ri.Name, Message: err.Error(), Err: ErrInvalidInput})
+			continue
+		}
+		result[ri.Name] = coerced
+	}
+
+	if len(problems) > 0 {
+		return nil, &InputError{Problems: problems}
+	}
+
+	return result, nil
+}
+
+// checkInputType checks that val is of type t. It returns val, or val
+// converted to t when it's a string holding a number or a number of
+// nanoseconds for a duration.
+func checkInputType(val interface{}, t string) (interface{}, error) {
+	if strings.HasPrefix(t, InputTypeList+"[") && strings.HasSuffix(t, "]") {
+		elemType := t[len(InputTypeList)+1 : len(t)-1]
+		return checkListType(val, elemType)
+	}
+
+	var ok bool
+	switch t {
+	case "":
+		ok = true
+	case InputTypeString:
+		_, ok = val.(string)
+	case InputTypeInt:
+		if n, isNum := numericString(val); isNum && n == math.Trunc(n) {
+			return n, nil
+		}
+		ok = isInt(val)
+	case InputTypeFloat:
+		if n, isNum := numericString(val); isNum {
+			return n, nil
+		}
+		ok = isInt(val) || isFloat(val)
+	case InputTypeBool:
+		_, ok = val.(bool)
+	case InputTypeMap:
+		ok = isMap(val)
+	case InputTypeList:
+		ok = val != nil && reflect.TypeOf(val).Kind() == reflect.Slice
+	case InputTypeDuration:
+		// a number is nanoseconds, the same as a Duration decoded from JSON.
+		if n, isNum := val.(float64); isNum && n == math.Trunc(n) {
+			return time.Duration(n).String(), nil
+		}
+		ok = isDuration(val)
+	case InputTypeTimestamp:
+		ok = isTimestamp(val)
+	default:
+		return nil, errors.Errorf("unknown input type %q", t)
+	}
+
+	if !ok {
+		return nil, errors.Errorf("expected %s, got %T", t, val)
+	}
+	return val, nil
+}
+
+func checkListType(val interface{}, elemType string) (interface{}, error) {
+	v := reflect.ValueOf(val)
+	if val == nil || v.Kind() != reflect.Slice {
+		return nil, errors.Errorf("expected %s, got %T", ListOf(elemType), val)
+	}
+
+	// only the elements of a list decoded from JSON can be converted.
+	elems, convertible := val.([]interface{})
+	var coerced []interface{}
+	if convertible {
+		coerced = make([]interface{}, len(elems))
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		elem, err := checkInputType(v.Index(i).Interface(), elemType)
+		if err != nil {
+			return nil, errors.Wrapf(err, "element %d", i)
+		}
+		if convertible {
+			coerced[i] = elem
+		}
+	}
+
+	if convertible {
+		return coerced, nil
+	}
+	return val, nil
+}
+
+// numericString parses val as a number, the same as numbers decoded from
+// JSON, when it's a string.
+func numericString(val interface{}) (float64, bool) {
+	s, ok := val.(string)
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, false
+	}
+	return n, true
+}
+
+func isInt(val interface{}) bool {
+	switch v := val.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	case float64:
+		// numbers decoded from JSON are always float64.
+		return v == math.Trunc(v)
+	case float32:
+		return float64(v) == math.Trunc(float64(v))
+	case json.Number:
+		_, err := v.Int64()
+		return err == nil
+	}
+	return false
+}
+
+func isFloat(val interface{}) bool {
+	switch v := val.(type) {
+	case float32, float64:
+		return true
+	case json.Number:
+		_, err := v.Float64()
+		return err == nil
+	}
+	return false
+}
+
+func isMap(val interface{}) bool {
+	switch val.(type) {
+	case map[string]interface{}, InputData:
+		return true
+	}
+	return false
+}
+
+func isDuration(val interface{}) bool {
+	switch v := val.(type) {
+	case time.Duration, Duration:
+		return true
+	case string:
+		_, err := time.ParseDuration(v)
+		return err == nil
+	}
+	return false
+}
+
+func isTimestamp(val interface{}) bool {
+	switch v := val.(type) {
+	case time.Time:
+		return true
+	case string:
+		_, err := time.Parse(time.RFC3339, v)
+		return err == nil
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package run_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/pkg/errors"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateInput(t *testing.T) {
+	tests := map[string]struct {
+		value    interface{}
+		typ      string
+		wantPass bool
+	}{
+		"string":                     {"foo", run.InputTypeString, true},
+		"not a string":               {10, run.InputTypeString, false},
+		"int":                        {10, run.InputTypeInt, true},
+		"int from json":              {float64(10), run.InputTypeInt, true},
+		"fractional int":             {10.5, run.InputTypeInt, false},
+		"string as int":              {"10", run.InputTypeInt, true},
+		"fractional string as int":   {"10.5", run.InputTypeInt, false},
+		"string as float":            {"10.5", run.InputTypeFloat, true},
+		"not a number":               {"ten", run.InputTypeFloat, false},
+		"float":                      {10.5, run.InputTypeFloat, true},
+		"int as float":               {10, run.InputTypeFloat, true},
+		"bool":                       {true, run.InputTypeBool, true},
+		"not a bool":                 {"true", run.InputTypeBool, false},
+		"map":                        {map[string]interface{}{"a": 1}, run.InputTypeMap, true},
+		"input data as map":          {run.InputData{"a": 1}, run.InputTypeMap, true},
+		"not a map":                  {[]interface{}{}, run.InputTypeMap, false},
+		"duration":                   {"1m30s", run.InputTypeDuration, true},
+		"duration from json":         {float64(time.Second), run.InputTypeDuration, true},
+		"not a duration":             {"soon", run.InputTypeDuration, false},
+		"timestamp":                  {"2019-10-01T10:00:00Z", run.InputTypeTimestamp, true},
+		"time as timestamp":          {time.Now(), run.InputTypeTimestamp, true},
+		"not a timestamp":            {"yesterday", run.InputTypeTimestamp, false},
+		"list":                       {[]interface{}{1, "a"}, run.InputTypeList, true},
+		"not a list":                 {"a", run.InputTypeList, false},
+		"list of ints":               {[]interface{}{float64(1), 2}, run.ListOf(run.InputTypeInt), true},
+		"list of int64":              {[]int64{1, 2}, run.ListOf(run.InputTypeInt), true},
+		"list of ints as strings":    {[]interface{}{"1", "2"}, run.ListOf(run.InputTypeInt), true},
+		"list with wrong element":    {[]interface{}{1, "a"}, run.ListOf(run.InputTypeInt), false},
+		"list of lists of strings":   {[]interface{}{[]interface{}{"a"}}, run.ListOf(run.ListOf(run.InputTypeString)), true},
+		"unknown type":               {"a", "thing", false},
+		"no type accepts everything": {"a", "", true},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			_, err := run.ValidateInput(run.InputData{"val": tc.value}, []run.Input{{Name: "val", Type: tc.typ}})
+			if tc.wantPass {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, run.ErrInvalidInput, errors.Cause(err))
+			}
+		})
+	}
+}
+
+func TestValidateInput_Coerces(t *testing.T) {
+	required := []run.Input{
+		{Name: "replicas", Type: run.InputTypeInt},
+		{Name: "ratio", Type: run.InputTypeFloat},
+		{Name: "ports", Type: run.ListOf(run.InputTypeInt)},
+		{Name: "bake", Type: run.InputTypeDuration},
+	}
+
+	d, err := run.ValidateInput(run.InputData{
+		"replicas": "5",
+		"ratio":    " 0.5 ",
+		"ports":    []interface{}{"80", float64(443)},
+		"bake":     float64(90 * time.Second),
+	}, required)
+	assert.Nil(t, err)
+	assert.Equal(t, run.InputData{
+		"replicas": float64(5),
+		"ratio":    0.5,
+		"ports":    []interface{}{float64(80), float64(443)},
+		"bake":     "1m30s",
+	}, d)
+	assert.Equal(t, 5, d.UnmarshalInt("replicas"))
+}
+
+func TestValidateInput_Optional(t *testing.T) {
+	required := []run.Input{
+		{Name: "region", Type: run.InputTypeString, Optional: true, Default: "us-east-1"},
+		{Name: "dry_run", Type: run.InputTypeBool, Optional: true},
+	}
+
+	d, err := run.ValidateInput(run.InputData{}, required)
+	assert.Nil(t, err)
+	assert.Equal(t, run.InputData{"region": "us-east-1"}, d)
+
+	input := run.InputData{"region": "eu-west-1"}
+	d, err = run.ValidateInput(input, required)
+	assert.Nil(t, err)
+	assert.Equal(t, "eu-west-1", d["region"])
+
+	_, err = run.ValidateInput(run.InputData{"dry_run": "yes"}, required)
+	assert.NotNil(t, err)
+}
+
+func TestValidateInput_ListsEveryProblem(t *testing.T) {
+	required := []run.Input{
+		{Name: "name", Type: run.InputTypeString},
+		{Name: "count", Type: run.InputTypeInt},
+		{Name: "tags", Type: run.ListOf(run.InputTypeString)},
+	}
+
+	_, err := run.ValidateInput(run.InputData{"count": "ten", "tags": []interface{}{"a"}}, required)
+	inputErr, ok := err.(*run.InputError)
+	if assert.True(t, ok) {
+		assert.Len(t, inputErr.Problems, 2)
+		assert.Equal(t, "name", inputErr.Problems[0].Name)
+		assert.Equal(t, "count", inputErr.Problems[1].Name)
+	}
+	assert.Equal(t, run.ErrMissingRequiredInput, errors.Cause(err))
+}
@@ -44,6 +44,25 @@ func (d InputData) UnmarshalSliceInt64(field string) []int64 {
 	return vals
 }
 
+func (d InputData) UnmarshalSliceString(field string) []string {
+	val, ok := d[field]
+	if !ok {
+		return []string{}
+	}
+
+	var vals []string
+	switch val.(type) {
+	case []string:
+		vals = append(vals, val.([]string)...)
+	case []interface{}:
+		for _, v := range val.([]interface{}) {
+			vals = append(vals, fmt.Sprint(v))
+		}
+	}
+
+	return vals
+}
+
 type converter func(m map[string]interface{}) interface{}
 
 func (d InputData) UnmarshalSlice(field string, c converter) []interface{} {
@@ -145,11 +164,25 @@ func unmarshalAsInt64(val interface{}) int64 {
 const InputTypeString = "string"
 const InputTypeInt = "int"
 const InputTypeList = "list"
+const InputTypeBool = "bool"
+const InputTypeFloat = "float"
+const InputTypeMap = "map"
+const InputTypeDuration = "duration"   // a duration string such as "1m30s".
+const InputTypeTimestamp = "timestamp" // an RFC3339 timestamp.
+
+// ListOf returns the input type of a list whose elements are all of type t.
+func ListOf(t string) string {
+	return fmt.Sprintf("%s[%s]", InputTypeList, t)
+}
 
 // Job is a definition of pipeline of work to perform.
 type Job struct {
 	Name  string `json:"name"`
 	Start *Step  `json:"start"`
+
+	// Input optionally declares the input the job is triggered with, which
+	// lets Validate check the required input of its steps.
+	Input []Input `json:"input"`
 }
 
 func NewJob(name string, start *Step) Job {
@@ -0,0 +1,142 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// JobStepperType is the step type of the JobStepper.
+const JobStepperType = "run_job"
+
+const (
+	jobNameKey  = "job_name"
+	jobScopeKey = "job_scope"
+	childRunKey = "child_run_uuid"
+)
+
+// DefaultChildPollInterval is how often a JobStepper checks on its child run.
+const DefaultChildPollInterval = 10 * time.Second
+
+// JobStepper is a Stepper that launches a run of another registered Job and
+// waits for it to finish. The step stays queued until the child run is
+// terminal, then takes on the child's final state and output. In the
+// meantime, the step is parked and the child is checked on every poll
+// interval. The uuid of the child is recorded in the ChildRun of the step.
+//
+// The child run is triggered with the input of the step and the scope in
+// job_scope, or the scope of the parent run when it's not provided.
+type JobStepper struct {
+	jobs         *JobStore
+	repo         Repo
+	pollInterval time.Duration
+}
+
+type JobStepperOption func(s *JobStepper)
+
+// WithChildPollInterval sets how often the child run is checked on.
+func WithChildPollInterval(d time.Duration) JobStepperOption {
+	return func(s *JobStepper) {
+		s.pollInterval = d
+	}
+}
+
+func NewJobStepper(jobs *JobStore, repo Repo, options ...JobStepperOption) *JobStepper {
+	s := &JobStepper{jobs: jobs, repo: repo, pollInterval: DefaultChildPollInterval}
+	for _, opt := range options {
+		opt(s)
+	}
+	return s
+}
+
+func (s *JobStepper) Type() string {
+	return JobStepperType
+}
+
+func (s *JobStepper) RequiredInput() []Input {
+	return []Input{{Name: jobNameKey, Type: InputTypeString}}
+}
+
+func (s *JobStepper) StepContext(ctx context.Context, d InputData) (Result, error) {
+	// the child run in the input may have been launched by an earlier step,
+	// so it's only awaited by the step that launched it.
+	stepUUID := d.UnmarshalString("step_uuid")
+	if childUUID := d.UnmarshalString(childRunKey); childUUID != "" && d.UnmarshalString(awaitingStepKey) == stepUUID {
+		return s.await(ctx, stepUUID, childUUID)
+	}
+
+	return s.launch(ctx, d)
+}
+
+func (s *JobStepper) launch(ctx context.Context, d InputData) (Result, error) {
+	j, err := s.jobs.Fetch(d.UnmarshalString(jobNameKey))
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "failed to fetch job %s", d.UnmarshalString(jobNameKey))
+	}
+
+	parentUUID := RunUUIDFromContext(ctx)
+	scope := d.UnmarshalString(jobScopeKey)
+	if scope == "" {
+		parent, err := s.repo.GetRun(ctx, parentUUID)
+		if err != nil {
+			return Result{}, errors.Wrapf(err, "failed to get parent run %s", parentUUID)
+		}
+		scope = parent.Scope
+	}
+
+	input := d.Merge(nil)
+	for _, k := range []string{"run_uuid", "step_uuid", jobNameKey, jobScopeKey, childRunKey, awaitingStepKey} {
+		delete(input, k)
+	}
+
+	child := NewRun(j, Trigger{
+		JobName:    j.Name,
+		Scope:      scope,
+		Input:      input,
+		ParentUUID: parentUUID,
+	})
+	if err := s.repo.CreateRun(ctx, child); err != nil {
+		return Result{}, errors.Wrap(err, "failed to create child run")
+	}
+
+	return s.wait(d.UnmarshalString("step_uuid"), child.UUID), nil
+}
+
+func (s *JobStepper) await(ctx context.Context, stepUUID, childUUID string) (Result, error) {
+	child, err := s.repo.GetRun(ctx, childUUID)
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "failed to get child run %s", childUUID)
+	}
+
+	if !child.Terminal() {
+		return s.wait(stepUUID, childUUID), nil
+	}
+
+	if err := child.UnmarshalRunData(); err != nil {
+		return Result{}, err
+	}
+
+	res := Result{
+		State:    child.State,
+		Data:     child.Output().Merge(InputData{childRunKey: childUUID}),
+		ChildRun: childUUID,
+	}
+	if child.State != StateSuccess {
+		res.Error = fmt.Sprintf("child run %s finished in state %s", childUUID, child.State)
+	}
+
+	return res, nil
+}
+
+// wait parks the step until the child run is next checked on.
+func (s *JobStepper) wait(stepUUID, childUUID string) Result {
+	wake := time.Now().UTC().Add(s.pollInterval)
+	return Result{
+		State:    StateQueued,
+		Data:     InputData{childRunKey: childUUID, awaitingStepKey: stepUUID},
+		WakeAt:   &wake,
+		ChildRun: childUUID,
+	}
+}
@@ -0,0 +1,140 @@
+package run_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobStepper(t *testing.T) {
+	finish := func(t *testing.T, repo *testhelpers.MemoryRepo, uuid string, state run.State) {
+		t.Helper()
+		child, err := repo.GetRun(context.Background(), uuid)
+		assert.Nil(t, err)
+		child.Steps.State = state
+		child.Steps.Output = testhelpers.CreateSampleResultWithOutput(state, "artifact", "build-1")
+		child.State = state
+		assert.Nil(t, repo.ReleaseRun(context.Background(), child))
+	}
+
+	tests := map[string]struct {
+		childState run.State
+		wantError  bool
+	}{
+		"child succeeds": {run.StateSuccess, false},
+		"child fails":    {run.StateFailed, true},
+		"child errors":   {run.StateError, true},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			repo := testhelpers.NewMemoryRepo()
+			js := run.NewJobsStore(testhelpers.CreateStepperStore())
+			js.Register(run.NewJob("build", testhelpers.CreateStep("say_hello")))
+			stepper := run.NewJobStepper(js, repo, run.WithChildPollInterval(time.Minute))
+
+			parent := testhelpers.CreateSampleRun("deploy", "app", run.InputData{"sha": "abc"})
+			assert.Nil(t, repo.CreateRun(context.Background(), parent))
+
+			ctx := run.NewStepContext(context.Background(), parent.UUID, parent.Steps.UUID)
+			input := run.InputData{"job_name": "build", "sha": "abc", "run_uuid": parent.UUID, "step_uuid": parent.Steps.UUID}
+			res, err := stepper.StepContext(ctx, input)
+			assert.Nil(t, err)
+			assert.Equal(t, run.StateQueued, res.State)
+
+			childUUID := res.Data.UnmarshalString("child_run_uuid")
+			child, err := repo.GetRun(context.Background(), childUUID)
+			assert.Nil(t, err)
+			assert.Equal(t, "build", child.JobName)
+			assert.Equal(t, "app", child.Scope)
+			assert.Equal(t, parent.UUID, *child.ParentUUID)
+			assert.Equal(t, run.InputData{"sha": "abc"}, child.Input)
+
+			assert.Equal(t, childUUID, res.ChildRun)
+
+			// the child hasn't finished, so the step is parked until it's
+			// checked on again.
+			input = input.Merge(res.Data)
+			res, err = stepper.StepContext(ctx, input)
+			assert.Nil(t, err)
+			assert.Equal(t, run.StateQueued, res.State)
+			assert.NotNil(t, res.WakeAt)
+			assert.WithinDuration(t, time.Now().Add(time.Minute), *res.WakeAt, 5*time.Second)
+
+			finish(t, repo, childUUID, tc.childState)
+			res, err = stepper.StepContext(ctx, input)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.childState, res.State)
+			assert.Equal(t, "build-1", res.Data["artifact"])
+			assert.Equal(t, childUUID, res.Data["child_run_uuid"])
+			assert.Equal(t, tc.wantError, res.Error != "")
+			assert.Nil(t, res.WakeAt)
+			assert.Equal(t, childUUID, res.ChildRun)
+		})
+	}
+
+	t.Run("with an unknown job", func(t *testing.T) {
+		stepper := run.NewJobStepper(run.NewJobsStore(testhelpers.CreateStepperStore()), testhelpers.NewMemoryRepo())
+		_, err := stepper.StepContext(context.Background(), run.InputData{"job_name": "nope", "job_scope": "app"})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestJobStepper_Chained(t *testing.T) {
+	repo := testhelpers.NewMemoryRepo()
+	js := run.NewJobsStore(testhelpers.CreateStepperStore())
+	js.Register(run.NewJob("build", testhelpers.CreateStep("say_hello")))
+	js.Register(run.NewJob("test", testhelpers.CreateStep("say_hello")))
+	stepper := run.NewJobStepper(js, repo, run.WithChildPollInterval(time.Minute))
+
+	parent := testhelpers.CreateSampleRun("deploy", "app", nil)
+	assert.Nil(t, repo.CreateRun(context.Background(), parent))
+
+	// the first step launches a build and takes on its output once it's done.
+	build := run.InputData{"job_name": "build", "run_uuid": parent.UUID, "step_uuid": parent.Steps.UUID}
+	ctx := run.NewStepContext(context.Background(), parent.UUID, parent.Steps.UUID)
+	res, err := stepper.StepContext(ctx, build)
+	assert.Nil(t, err)
+	buildUUID := res.ChildRun
+
+	child, err := repo.GetRun(context.Background(), buildUUID)
+	assert.Nil(t, err)
+	child.Steps.State = run.StateSuccess
+	child.State = run.StateSuccess
+	assert.Nil(t, repo.ReleaseRun(context.Background(), child))
+
+	res, err = stepper.StepContext(ctx, build.Merge(res.Data))
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateSuccess, res.State)
+
+	// the next step receives the output of the first one, including the uuid
+	// of the build, but launches its own job.
+	next := parent.Steps.OnSuccess
+	test := build.Merge(res.Data).Merge(run.InputData{"job_name": "test", "step_uuid": next.UUID})
+	ctx = run.NewStepContext(context.Background(), parent.UUID, next.UUID)
+	res, err = stepper.StepContext(ctx, test)
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateQueued, res.State)
+	assert.NotEqual(t, buildUUID, res.ChildRun)
+
+	child, err = repo.GetRun(context.Background(), res.ChildRun)
+	assert.Nil(t, err)
+	assert.Equal(t, "test", child.JobName)
+	assert.NotContains(t, child.Input, "child_run_uuid")
+	assert.NotContains(t, child.Input, "awaiting_step_uuid")
+}
+
+func TestRun_Children(t *testing.T) {
+	r := testhelpers.CreateSampleRun("deploy", "app", nil)
+	assert.Empty(t, r.Children())
+
+	r.Steps.ChildRun = "RU-1"
+	r.Steps.OnSuccess.OnSuccess.ChildRun = "RU-2"
+	assert.Equal(t, []string{"RU-1", "RU-2"}, r.Children())
+}
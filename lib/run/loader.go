@@ -0,0 +1,264 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// JobDefinition is the declarative form of a Job that can be loaded from a
+// YAML or JSON file. Steps are declared by name and reference each other
+// through their edges, starting from the step named in Start.
+type JobDefinition struct {
+	Name  string                    `json:"name"`
+	Start string                    `json:"start"`
+	Input []Input                   `json:"input"`
+	Steps map[string]StepDefinition `json:"steps"`
+}
+
+// StepDefinition is the declarative form of a step template. The edges hold
+// the names of other steps in the same JobDefinition.
+type StepDefinition struct {
+	Type      string            `json:"type"`
+	Input     InputData         `json:"input"`
+	OnSuccess string            `json:"on_success"`
+	OnFailure string            `json:"on_failure"`
+	Branches  []string          `json:"branches"`
+	Quorum    int               `json:"quorum"`
+	Outcomes  map[string]string `json:"outcomes"`
+	Retry     *RetryPolicy      `json:"retry"`
+	Timeout   Duration          `json:"timeout"`
+
+	// Compensate is the type of the step that undoes this one. See
+	// Step.Compensate.
+	Compensate string `json:"compensate"`
+}
+
+// Build creates the Job described by the definition.
+func (d JobDefinition) Build() (Job, error) {
+	if d.Name == "" {
+		return Job{}, errors.New("job definition is missing a name")
+	}
+
+	b := jobBuilder{def: d, visiting: make(map[string]bool)}
+	start, err := b.step(d.Start)
+	if err != nil {
+		return Job{}, errors.Wrapf(err, "invalid job %s", d.Name)
+	}
+
+	j := NewJob(d.Name, start)
+	j.Input = d.Input
+	return j, nil
+}
+
+type jobBuilder struct {
+	def      JobDefinition
+	visiting map[string]bool
+}
+
+func (b *jobBuilder) step(name string) (*Step, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	sd, ok := b.def.Steps[name]
+	if !ok {
+		return nil, errors.Errorf("step %q is not defined", name)
+	}
+	if b.visiting[name] {
+		return nil, errors.Errorf("step %q is part of a cycle", name)
+	}
+	if sd.Type == "" {
+		return nil, errors.Errorf("step %q is missing a type", name)
+	}
+
+	b.visiting[name] = true
+	defer delete(b.visiting, name)
+
+	s := &Step{
+		Input:      sd.Input,
+		StepType:   sd.Type,
+		Quorum:     sd.Quorum,
+		Retry:      sd.Retry,
+		Timeout:    sd.Timeout,
+		Compensate: sd.Compensate,
+	}
+
+	var err error
+	if s.OnSuccess, err = b.step(sd.OnSuccess); err != nil {
+		return nil, err
+	}
+	if s.OnFailure, err = b.step(sd.OnFailure); err != nil {
+		return nil, err
+	}
+
+	for _, branch := range sd.Branches {
+		bs, err := b.step(branch)
+		if err != nil {
+			return nil, err
+		}
+		if bs == nil {
+			return nil, errors.Errorf("step %q has an empty branch", name)
+		}
+		s.Branches = append(s.Branches, bs)
+	}
+
+	if len(sd.Outcomes) > 0 {
+		s.Outcomes = make(map[string]*Step, len(sd.Outcomes))
+		for outcome, next := range sd.Outcomes {
+			if s.Outcomes[outcome], err = b.step(next); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// ParseJobDefinitions parses the job definitions in data, which can hold
+// either a single definition or a list of them. YAML is a superset of JSON,
+// so both formats are accepted.
+func ParseJobDefinitions(data []byte) ([]JobDefinition, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, errors.Wrap(err, "failed to parse job definitions")
+	}
+
+	// YAML decodes objects with interface{} keys, so the definitions are
+	// normalized to JSON to decode them with the same rules as JSON files.
+	normalized, err := json.Marshal(normalizeYAML(raw))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to normalize job definitions")
+	}
+
+	var defs []JobDefinition
+	if _, ok := raw.([]interface{}); ok {
+		err = json.Unmarshal(normalized, &defs)
+	} else {
+		var def JobDefinition
+		err = json.Unmarshal(normalized, &def)
+		defs = append(defs, def)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode job definitions")
+	}
+
+	return defs, nil
+}
+
+func normalizeYAML(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, v := range val {
+			m[fmt.Sprintf("%v", k)] = normalizeYAML(v)
+		}
+		return m
+	case []interface{}:
+		for i, v := range val {
+			val[i] = normalizeYAML(v)
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+// LoadJobs reads the job definitions in path, which is either a file or a
+// directory of .yaml, .yml and .json files. Every job is built and validated
+// against the steppers in ss before any of them are registered in js.
+func LoadJobs(path string, ss *StepperStore, js *JobStore) error {
+	files, err := definitionFiles(path)
+	if err != nil {
+		return err
+	}
+
+	var jobs []Job
+	var problems []Problem
+	names := make(map[string]string)
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", f)
+		}
+
+		defs, err := ParseJobDefinitions(data)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load %s", f)
+		}
+
+		for _, def := range defs {
+			j, err := def.Build()
+			if err != nil {
+				return errors.Wrapf(err, "failed to load %s", f)
+			}
+
+			if err := j.Validate(ss); err != nil {
+				verr, ok := err.(*ValidationError)
+				if !ok {
+					return errors.Wrapf(err, "failed to validate %s", f)
+				}
+				problems = append(problems, verr.Problems...)
+			}
+
+			if other, ok := names[j.Name]; ok {
+				problems = append(problems, Problem{Job: j.Name, Message: fmt.Sprintf("defined in both %s and %s", other, f)})
+			}
+			names[j.Name] = f
+			jobs = append(jobs, j)
+		}
+	}
+
+	for _, j := range jobs {
+		if _, err := js.Fetch(j.Name); err == nil {
+			problems = append(problems, Problem{Job: j.Name, Message: "a job with this name is already registered"})
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	for _, j := range jobs {
+		if err := js.Register(j); err != nil {
+			return errors.Wrapf(err, "failed to register job %s", j.Name)
+		}
+	}
+
+	return nil
+}
+
+func definitionFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to stat %s", path)
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read directory %s", path)
+	}
+
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".yaml", ".yml", ".json":
+			files = append(files, filepath.Join(path, e.Name()))
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,142 @@
+package run_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const deployYAML = `
+name: deploy
+start: hello
+steps:
+  hello:
+    type: say_hello
+    input:
+      region: us-east-1
+      tags:
+        team: infra
+    on_success: ask
+    on_failure: goodbye
+    timeout: 5m
+    retry:
+      max_attempts: 3
+      initial_backoff: 10s
+  ask:
+    type: ask_question
+    compensate: say_goodbye2
+    branches: [goodbye, goodbye2]
+    quorum: 1
+    outcomes:
+      hold: goodbye2
+  goodbye:
+    type: say_goodbye1
+  goodbye2:
+    type: say_goodbye2
+`
+
+const jobsJSON = `[
+  {"name": "build", "start": "hello", "steps": {"hello": {"type": "say_hello"}}},
+  {"name": "test", "start": "ask", "steps": {"ask": {"type": "ask_question", "on_success": "bye"}, "bye": {"type": "say_goodbye1"}}}
+]`
+
+func TestParseJobDefinitions(t *testing.T) {
+	defs, err := run.ParseJobDefinitions([]byte(deployYAML))
+	assert.Nil(t, err)
+	assert.Len(t, defs, 1)
+
+	j, err := defs[0].Build()
+	assert.Nil(t, err)
+	assert.Equal(t, "deploy", j.Name)
+
+	hello := j.Start
+	assert.Equal(t, "say_hello", hello.StepType)
+	assert.Equal(t, "us-east-1", hello.Input["region"])
+	assert.Equal(t, map[string]interface{}{"team": "infra"}, hello.Input["tags"])
+	assert.Equal(t, 3, hello.Retry.MaxAttempts)
+	assert.Equal(t, run.Duration(10*time.Second), hello.Retry.InitialBackoff)
+	assert.Equal(t, run.Duration(5*time.Minute), hello.Timeout)
+	assert.Equal(t, "say_goodbye1", hello.OnFailure.StepType)
+
+	ask := hello.OnSuccess
+	assert.Equal(t, "ask_question", ask.StepType)
+	assert.Equal(t, 1, ask.Quorum)
+	assert.Equal(t, "say_goodbye2", ask.Compensate)
+	assert.Len(t, ask.Branches, 2)
+	assert.Equal(t, "say_goodbye2", ask.Outcomes["hold"].StepType)
+
+	defs, err = run.ParseJobDefinitions([]byte(jobsJSON))
+	assert.Nil(t, err)
+	assert.Len(t, defs, 2)
+	assert.Equal(t, "test", defs[1].Name)
+}
+
+func TestJobDefinition_Build(t *testing.T) {
+	tests := map[string]run.JobDefinition{
+		"missing name":     {Start: "a", Steps: map[string]run.StepDefinition{"a": {Type: "say_hello"}}},
+		"missing start":    {Name: "job", Start: "b", Steps: map[string]run.StepDefinition{"a": {Type: "say_hello"}}},
+		"undefined edge":   {Name: "job", Start: "a", Steps: map[string]run.StepDefinition{"a": {Type: "say_hello", OnSuccess: "b"}}},
+		"missing type":     {Name: "job", Start: "a", Steps: map[string]run.StepDefinition{"a": {}}},
+		"with a cycle":     {Name: "job", Start: "a", Steps: map[string]run.StepDefinition{"a": {Type: "say_hello", OnSuccess: "b"}, "b": {Type: "say_hello", OnFailure: "a"}}},
+		"with a self loop": {Name: "job", Start: "a", Steps: map[string]run.StepDefinition{"a": {Type: "say_hello", Branches: []string{"a"}}}},
+	}
+
+	for name, def := range tests {
+		def := def
+		t.Run(name, func(t *testing.T) {
+			_, err := def.Build()
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestLoadJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "deploy.yaml"), []byte(deployYAML), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "jobs.json"), []byte(jobsJSON), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("not a job"), 0644))
+
+	t.Run("from a directory", func(t *testing.T) {
+		js := run.NewJobsStore(testhelpers.CreateStepperStore())
+		assert.Nil(t, run.LoadJobs(dir, testhelpers.CreateStepperStore(), js))
+		assert.Len(t, js.Jobs(), 3)
+		_, err := js.Fetch("deploy")
+		assert.Nil(t, err)
+	})
+
+	t.Run("from a file", func(t *testing.T) {
+		js := run.NewJobsStore(testhelpers.CreateStepperStore())
+		assert.Nil(t, run.LoadJobs(filepath.Join(dir, "jobs.json"), testhelpers.CreateStepperStore(), js))
+		assert.Len(t, js.Jobs(), 2)
+	})
+
+	t.Run("with an unregistered stepper", func(t *testing.T) {
+		js := run.NewJobsStore(testhelpers.CreateStepperStore())
+		assert.NotNil(t, run.LoadJobs(dir, run.NewStepperStore(), js))
+		assert.Len(t, js.Jobs(), 0)
+	})
+
+	t.Run("with a job that is already registered", func(t *testing.T) {
+		js := run.NewJobsStore(testhelpers.CreateStepperStore())
+		assert.Nil(t, js.Register(testhelpers.CreateSampleJob("build")))
+		err := run.LoadJobs(dir, testhelpers.CreateStepperStore(), js)
+		if assert.IsType(t, &run.ValidationError{}, err) {
+			assert.Equal(t, "build", err.(*run.ValidationError).Problems[0].Job)
+		}
+		assert.Len(t, js.Jobs(), 1)
+	})
+
+	t.Run("with a missing path", func(t *testing.T) {
+		assert.NotNil(t, run.LoadJobs(filepath.Join(dir, "nope"), testhelpers.CreateStepperStore(), run.NewJobsStore(testhelpers.CreateStepperStore())))
+	})
+}
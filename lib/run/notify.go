@@ -0,0 +1,102 @@
+package run
+
+import (
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/mitchfriedman/workflow/lib/logging"
+)
+
+// RunsChannel is the Postgres channel that is notified whenever a run is
+// created, or released after it moved forward, since that may make a run
+// ready to execute. The payload is the uuid of the run, followed by the uuid
+// of the worker that released it, if any.
+const RunsChannel = "workflow_runs"
+
+func notificationPayload(runUUID, releasedBy string) string {
+	if releasedBy == "" {
+		return runUUID
+	}
+	return runUUID + " " + releasedBy
+}
+
+func releasedBy(payload string) string {
+	if i := strings.Index(payload, " "); i >= 0 {
+		return payload[i+1:]
+	}
+	return ""
+}
+
+// Listener delivers a value on Notifications whenever runs may be ready to
+// execute. Notifications are coalesced, so a single value can stand for many
+// of them.
+type Listener interface {
+	Notifications() <-chan struct{}
+}
+
+// PostgresListener is a Listener that listens on RunsChannel.
+type PostgresListener struct {
+	l      *pq.Listener
+	c      chan struct{}
+	worker string
+}
+
+type ListenerOption func(p *PostgresListener)
+
+// IgnoreReleasesBy ignores the notifications of the runs released by the
+// worker, since the engine of the worker looks for more work by itself after
+// releasing a run.
+func IgnoreReleasesBy(workerID string) ListenerOption {
+	return func(p *PostgresListener) {
+		p.worker = workerID
+	}
+}
+
+// NewPostgresListener starts listening on RunsChannel of the database at url.
+// It reconnects by itself if the connection is lost.
+func NewPostgresListener(url string, logger logging.StructuredLogger, options ...ListenerOption) (*PostgresListener, error) {
+	l := pq.NewListener(url, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Errorf("run listener: %v", err)
+		}
+	})
+	if err := l.Listen(RunsChannel); err != nil {
+		l.Close()
+		return nil, errors.Wrapf(err, "failed to listen on %s", RunsChannel)
+	}
+
+	p := &PostgresListener{l: l, c: make(chan struct{}, 1)}
+	for _, opt := range options {
+		opt(p)
+	}
+	go p.forward()
+	return p, nil
+}
+
+// forward coalesces the notifications of the connection. A nil notification
+// is sent after a reconnect, when notifications may have been missed, so it
+// wakes up the engine as well. Notifications stop once the listener is
+// closed, leaving the engine to poll.
+func (p *PostgresListener) forward() {
+	for n := range p.l.Notify {
+		if n != nil && p.worker != "" && releasedBy(n.Extra) == p.worker {
+			continue
+		}
+
+		select {
+		case p.c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (p *PostgresListener) Notifications() <-chan struct{} {
+	return p.c
+}
+
+func (p *PostgresListener) Close() error {
+	return p.l.Close()
+}
@@ -0,0 +1,67 @@
+package run
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrStepNotFound = errors.New("step not found")
+var ErrStepNotOverridable = errors.New("only a step the run is waiting on can be skipped or failed")
+
+// Skip completes a step the run is waiting on as if its Stepper had
+// succeeded, with data as its output, so that the run carries on from it.
+// The reason is recorded in the history of the run.
+func (r *Run) Skip(stepUUID string, data InputData, reason string, now time.Time) error {
+	return r.override(EventSkip, stepUUID, Result{State: StateSuccess, Data: data}, reason, now)
+}
+
+// ForceFail fails a step the run is waiting on as if its Stepper had failed,
+// with data as its output, so that its OnFailure step is executed. The
+// reason is used as the failure message and recorded in the history of the
+// run.
+func (r *Run) ForceFail(stepUUID string, data InputData, reason string, now time.Time) error {
+	data = InputData{}.Merge(data)
+	data[failureMessage] = reason
+	return r.override(EventForceFail, stepUUID, Result{State: StateFailed, Data: data, Error: reason}, reason, now)
+}
+
+func (r *Run) override(event string, stepUUID string, res Result, reason string, now time.Time) error {
+	s := r.FindStep(stepUUID)
+	if s == nil {
+		return ErrStepNotFound
+	}
+	if r.Terminal() || !current(r, s) {
+		return ErrStepNotOverridable
+	}
+
+	r.History = append(r.History, Event{
+		Type:   event,
+		Time:   now,
+		State:  r.State,
+		Steps:  []string{s.UUID},
+		Reason: reason,
+	})
+
+	s.State = res.State
+	s.Output = res
+	s.Signal = ""
+	s.NotBefore = nil
+	s.Started = nil
+
+	r.LastStepComplete = &now
+	r.Resolve()
+	return nil
+}
+
+func current(r *Run, s *Step) bool {
+	if s.State != StateQueued {
+		return false
+	}
+	for _, c := range r.CurrentSteps() {
+		if c == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package run_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun_Skip(t *testing.T) {
+	now := time.Now().UTC()
+	r := testhelpers.CreateSampleRun("job", "s1", nil)
+	hello := r.Steps
+	hello.Signal = "deployed"
+
+	assert.Equal(t, run.ErrStepNotFound, r.Skip("missing", nil, "stuck", now))
+	assert.Equal(t, run.ErrStepNotOverridable, r.Skip(hello.OnSuccess.UUID, nil, "stuck", now))
+
+	assert.Nil(t, r.Skip(hello.UUID, run.InputData{"greeting": "hi"}, "stuck", now))
+	assert.Equal(t, run.StateSuccess, hello.State)
+	assert.Equal(t, run.Result{State: run.StateSuccess, Data: run.InputData{"greeting": "hi"}}, hello.Output)
+	assert.Empty(t, hello.Signal)
+	assert.Equal(t, run.StateQueued, r.State)
+	assert.False(t, r.Rollback)
+	assert.Equal(t, &now, r.LastStepComplete)
+	assert.Equal(t, hello.OnSuccess, r.CurrentStep())
+	assert.Equal(t, []run.Event{
+		{Type: run.EventSkip, Time: now, State: run.StateQueued, Steps: []string{hello.UUID}, Reason: "stuck"},
+	}, r.History)
+
+	// a step that has completed can't be skipped again.
+	assert.Equal(t, run.ErrStepNotOverridable, r.Skip(hello.UUID, nil, "stuck", now))
+}
+
+func TestRun_ForceFail(t *testing.T) {
+	now := time.Now().UTC()
+	r := testhelpers.CreateSampleRun("job", "s1", nil)
+	hello := r.Steps
+
+	assert.Nil(t, r.ForceFail(hello.UUID, run.InputData{"host": "h1"}, "host is gone", now))
+	assert.Equal(t, run.StateFailed, hello.State)
+	assert.Equal(t, run.Result{
+		State: run.StateFailed,
+		Data:  run.InputData{"host": "h1", "failure_message": "host is gone"},
+		Error: "host is gone",
+	}, hello.Output)
+	assert.True(t, r.Rollback)
+	assert.Equal(t, hello.OnFailure, r.CurrentStep())
+	assert.Equal(t, run.EventForceFail, r.History[0].Type)
+
+	r.State = run.StateError
+	assert.Equal(t, run.ErrStepNotOverridable, r.ForceFail(hello.OnFailure.UUID, nil, "host is gone", now))
+}
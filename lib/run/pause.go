@@ -0,0 +1,42 @@
+package run
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrNotPausable = errors.New("a finished run can't be paused")
+var ErrNotPaused = errors.New("run is not paused")
+
+// Pause freezes the run: it is never claimed again until it's resumed, and
+// it holds up the other runs of its job and scope in the meantime. A step
+// that is executing when the run is paused is allowed to finish.
+func (r *Run) Pause(now time.Time) error {
+	if r.Terminal() {
+		return ErrNotPausable
+	}
+	if r.Paused {
+		return nil
+	}
+
+	r.History = append(r.History, Event{Type: EventPause, Time: now, State: r.State})
+	r.Paused = true
+	return nil
+}
+
+// Resume lets a paused run be executed again.
+func (r *Run) Resume(now time.Time) error {
+	if !r.Paused {
+		return ErrNotPaused
+	}
+
+	r.History = append(r.History, Event{Type: EventResume, Time: now, State: r.State})
+	r.Paused = false
+
+	// the time spent paused doesn't count against the progress of the run.
+	if r.LastStepComplete != nil {
+		r.LastStepComplete = &now
+	}
+	return nil
+}
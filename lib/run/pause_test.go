@@ -0,0 +1,38 @@
+package run_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun_Pause(t *testing.T) {
+	now := time.Now().UTC()
+	lastStep := now.Add(-time.Hour)
+
+	r := testhelpers.CreateSampleRunFirstStepSuccess("job", "s1", nil)
+	r.LastStepComplete = &lastStep
+
+	assert.Equal(t, run.ErrNotPaused, r.Resume(now))
+	assert.Nil(t, r.Pause(now))
+	assert.True(t, r.Paused)
+
+	// pausing a paused run does nothing.
+	assert.Nil(t, r.Pause(now))
+	assert.Len(t, r.History, 1)
+
+	assert.Nil(t, r.Resume(now))
+	assert.False(t, r.Paused)
+	assert.Equal(t, &now, r.LastStepComplete)
+	assert.Equal(t, []run.Event{
+		{Type: run.EventPause, Time: now, State: run.StateQueued},
+		{Type: run.EventResume, Time: now, State: run.StateQueued},
+	}, r.History)
+
+	r.State = run.StateSuccess
+	assert.Equal(t, run.ErrNotPausable, r.Pause(now))
+}
@@ -14,6 +14,10 @@ import (
 
 var ErrNotFound = errors.New("record not found")
 
+// ErrConflict is returned when a run is written based on a stale copy, since
+// it was modified by someone else after it was read.
+var ErrConflict = errors.New("run was modified concurrently")
+
 type Repo interface {
 	Creator
 	Retriever
@@ -30,14 +34,77 @@ type Retriever interface {
 }
 
 type Claimer interface {
+	// GetLatestRun reads the run from the primary database, so that it's
+	// never a stale copy from a replica that is lagging behind.
+	GetLatestRun(context.Context, string) (*Run, error)
+	ClaimNextRun(context.Context, string, time.Duration, Prioritizer) (*Run, error)
 	ClaimRun(context.Context, *Run, string, time.Duration) error
 	ReleaseRun(context.Context, *Run) error
+	// SaveRun writes the run like ReleaseRun, but leaves its claim alone.
+	SaveRun(context.Context, *Run) error
 }
 
+// Prioritizer picks the run to execute next out of the queued runs, or nil if
+// none of them can be executed.
+type Prioritizer func([]*Run) *Run
+
 type Creator interface {
 	CreateRun(context.Context, *Run) error
 }
 
+// maxConflictRetries is the number of times Update retries a write that
+// conflicted with another writer, backing off by conflictBackoff, doubled on
+// every retry, in between.
+const (
+	maxConflictRetries = 3
+	conflictBackoff    = 10 * time.Millisecond
+)
+
+// Update applies f to r, which must have its run data unmarshalled, and
+// releases it. If r was modified by someone else in the meantime, f is applied
+// again to a fresh copy of the run, read with GetLatestRun. Update returns the
+// run as it was written, or the error returned by f.
+func Update(ctx context.Context, repo Repo, r *Run, f func(*Run) error) (*Run, error) {
+	return update(ctx, repo, r, f, repo.ReleaseRun)
+}
+
+// Modify is like Update, but it keeps the claim of the worker that may be
+// executing r, so that another worker can't claim the run until the steps of
+// the first one have finished. It's for changes made from outside the engine,
+// such as through the API.
+func Modify(ctx context.Context, repo Repo, r *Run, f func(*Run) error) (*Run, error) {
+	return update(ctx, repo, r, f, repo.SaveRun)
+}
+
+func update(ctx context.Context, repo Repo, r *Run, f func(*Run) error, write func(context.Context, *Run) error) (*Run, error) {
+	for i := 0; ; i++ {
+		if err := f(r); err != nil {
+			return nil, err
+		}
+
+		err := write(ctx, r)
+		if err == nil {
+			return r, nil
+		}
+		if err != ErrConflict || i >= maxConflictRetries {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(conflictBackoff << uint(i)):
+		}
+
+		if r, err = repo.GetLatestRun(ctx, r.UUID); err != nil {
+			return nil, err
+		}
+		if err := r.UnmarshalRunData(); err != nil {
+			return nil, err
+		}
+	}
+}
+
 type Storage struct {
 	db *database.DB
 }
@@ -47,7 +114,11 @@ func NewDatabaseStorage(db *database.DB) *Storage {
 }
 
 func (r *Storage) GetRun(ctx context.Context, uuid string) (*Run, error) {
-	return r.getRunByUUID(ctx, uuid)
+	return r.getRunByUUID(ctx, r.db.Reader, uuid)
+}
+
+func (r *Storage) GetLatestRun(ctx context.Context, uuid string) (*Run, error) {
+	return r.getRunByUUID(ctx, r.db.Master, uuid)
 }
 
 func (r *Storage) SearchForRun(ctx context.Context, job, scope, state string) (*Run, error) {
@@ -73,9 +144,9 @@ func (r *Storage) SearchForRun(ctx context.Context, job, scope, state string) (*
 	}
 }
 
-func (r *Storage) getRunByUUID(ctx context.Context, uuid string) (*Run, error) {
+func (r *Storage) getRunByUUID(ctx context.Context, conn *gorm.DB, uuid string) (*Run, error) {
 	var run Run
-	span, db, ctx := tracing.NewDBSpan(ctx, r.db.Reader, "run.getRunByUUID")
+	span, db, ctx := tracing.NewDBSpan(ctx, conn, "run.getRunByUUID")
 	err := db.
 		Model(&run).
 		Where("uuid = ?", uuid).
@@ -93,18 +164,40 @@ func (r *Storage) getRunByUUID(ctx context.Context, uuid string) (*Run, error) {
 }
 
 func (r *Storage) CreateRun(ctx context.Context, d *Run) error {
+	return InsertRun(ctx, r.db.Master, d)
+}
+
+// InsertRun creates the run with conn, which can be a transaction, so that
+// the run is created along with the other writes of the transaction. The
+// engines are notified once the transaction commits.
+func InsertRun(ctx context.Context, conn *gorm.DB, d *Run) error {
 	err := d.MarshalRunData()
 	if err != nil {
 		return err
 	}
 	d.Started = time.Now().UTC()
 
-	span, db, ctx := tracing.NewDBSpan(ctx, r.db.Master, "run.create_run")
+	span, db, ctx := tracing.NewDBSpan(ctx, conn, "run.create_run")
 	err = db.Create(&d).Error
 	span.RecordError(err)
 	span.Finish()
 
-	return err
+	if err != nil {
+		return err
+	}
+
+	d.read = d.progress()
+	notify(ctx, conn, d, "")
+	return nil
+}
+
+// notify wakes up the engines listening on RunsChannel. A notification that
+// fails to send is not an error, since engines fall back to polling.
+func notify(ctx context.Context, conn *gorm.DB, d *Run, releasedBy string) {
+	span, db, _ := tracing.NewDBSpan(ctx, conn, "run.notify")
+	err := db.Exec("SELECT pg_notify(?, ?)", RunsChannel, notificationPayload(d.UUID, releasedBy)).Error
+	span.RecordError(err)
+	span.Finish()
 }
 
 func (r *Storage) NextRuns(ctx context.Context) ([]*Run, error) {
@@ -112,6 +205,7 @@ func (r *Storage) NextRuns(ctx context.Context) ([]*Run, error) {
 	span, db, ctx := tracing.NewDBSpan(ctx, r.db.Reader, "run.next_runs")
 	err := db.
 		Where("state = ?", StateQueued).
+		Where("not_before IS NULL OR not_before <= ?", time.Now().UTC()).
 		Find(&runs).Error
 	span.RecordError(err)
 	span.Finish()
@@ -137,28 +231,194 @@ func (r *Storage) ClaimRun(ctx context.Context, t *Run, workerID string, d time.
 	}
 
 	n := time.Now().UTC().Add(d)
-	t.ClaimedBy = &workerID
-	t.ClaimedUntil = &n
+	updates := map[string]interface{}{
+		"claimed_by":         workerID,
+		"claimed_until":      n,
+		"data":               t.Data,
+		"last_step_complete": t.LastStepComplete,
+		"version":            t.Version + 1,
+	}
 
 	span, db, ctx := tracing.NewDBSpan(ctx, r.db.Master, "run.claim_run")
-	err = db.
-		Model(&t).
-		Where("uuid = ?", t.UUID).
-		Updates(t).Error
-	span.RecordError(err)
+	res := db.
+		Table("runs").
+		Where("uuid = ? AND version = ?", t.UUID, t.Version).
+		Updates(updates)
+	span.RecordError(res.Error)
 	span.Finish()
 
-	return err
+	switch {
+	case res.Error != nil:
+		return res.Error
+	case res.RowsAffected == 0:
+		return ErrConflict
+	}
+
+	t.ClaimedBy = &workerID
+	t.ClaimedUntil = &n
+	t.Version++
+	return nil
+}
+
+// ClaimNextRun atomically claims the run picked by prioritize for workerID.
+//
+// Runs of the same job and scope form a queue that prioritize serializes, so
+// workers that pick from the same queue take turns through an advisory lock
+// held until the claim is committed. The queue is read again once the lock is
+// held, so a claim committed by another worker in the meantime is seen.
+// Queues that are locked by another worker are skipped rather than waited on.
+func (r *Storage) ClaimNextRun(ctx context.Context, workerID string, d time.Duration, prioritize Prioritizer) (_ *Run, err error) {
+	span, db, ctx := tracing.NewDBSpan(ctx, r.db.Master, "run.claim_next_run")
+	defer func() {
+		span.RecordError(err)
+		span.Finish()
+	}()
+
+	tx := db.BeginTx(ctx, nil)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "failed to begin transaction")
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	runs, err := queuedRuns(tx.
+		Where("state = ?", StateQueued).
+		Where("not_before IS NULL OR not_before <= ?", time.Now().UTC()))
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		candidate := prioritize(runs)
+		if candidate == nil {
+			return nil, tx.Commit().Error
+		}
+
+		claimed, err := claimFromQueue(tx, candidate.JobName, candidate.Scope, workerID, d, prioritize)
+		if err != nil {
+			return nil, err
+		}
+		if claimed != nil {
+			if err := tx.Commit().Error; err != nil {
+				return nil, errors.Wrap(err, "failed to commit claim")
+			}
+			return claimed, nil
+		}
+
+		// the queue is busy, try the others.
+		runs = withoutQueue(runs, candidate.JobName, candidate.Scope)
+	}
+}
+
+func claimFromQueue(tx *gorm.DB, job, scope, workerID string, d time.Duration, prioritize Prioritizer) (*Run, error) {
+	var lock struct {
+		Locked bool
+	}
+	err := tx.
+		Raw("SELECT pg_try_advisory_xact_lock(hashtext(?)) AS locked", job+"-"+scope).
+		Scan(&lock).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to lock queue %s-%s", job, scope)
+	}
+	if !lock.Locked {
+		return nil, nil
+	}
+
+	queue, err := queuedRuns(tx.
+		Where("state = ? AND job_name = ? AND scope = ?", StateQueued, job, scope).
+		Where("not_before IS NULL OR not_before <= ?", time.Now().UTC()))
+	if err != nil {
+		return nil, err
+	}
+
+	next := prioritize(queue)
+	if next == nil {
+		return nil, nil
+	}
+
+	var locked Run
+	err = tx.
+		Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
+		Where("uuid = ? AND claimed_by IS NULL AND NOT paused", next.UUID).
+		First(&locked).Error
+	switch err {
+	case nil:
+	case gorm.ErrRecordNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Wrapf(err, "failed to lock run %s", next.UUID)
+	}
+
+	n := time.Now().UTC().Add(d)
+	err = tx.
+		Table("runs").
+		Where("uuid = ?", next.UUID).
+		Updates(map[string]interface{}{
+			"claimed_by":    workerID,
+			"claimed_until": n,
+			"version":       locked.Version + 1,
+		}).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to claim run %s", next.UUID)
+	}
+
+	next.ClaimedBy = &workerID
+	next.ClaimedUntil = &n
+	next.Version = locked.Version + 1
+	return next, nil
+}
+
+func queuedRuns(db *gorm.DB) ([]*Run, error) {
+	var runs []*Run
+	if err := db.Find(&runs).Error; err != nil {
+		return nil, errors.Wrap(err, "failed to query for queued runs")
+	}
+
+	for _, r := range runs {
+		if err := r.UnmarshalRunData(); err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+func withoutQueue(runs []*Run, job, scope string) []*Run {
+	var rest []*Run
+	for _, r := range runs {
+		if r.JobName != job || r.Scope != scope {
+			rest = append(rest, r)
+		}
+	}
+	return rest
 }
 
 func (r *Storage) ReleaseRun(ctx context.Context, d *Run) error {
+	return r.write(ctx, d, true)
+}
+
+func (r *Storage) SaveRun(ctx context.Context, d *Run) error {
+	return r.write(ctx, d, false)
+}
+
+// write writes d if it hasn't been modified since it was read, and releases
+// its claim if release is set.
+func (r *Storage) write(ctx context.Context, d *Run, release bool) error {
 	err := d.MarshalRunData()
 	if err != nil {
 		return err
 	}
 
-	d.ClaimedBy = nil
-	d.ClaimedUntil = nil
+	var releasedBy string
+	if release && d.ClaimedBy != nil {
+		releasedBy = *d.ClaimedBy
+	}
+	moved := d.progress() != d.read
+
+	operation := "run.save_run"
+	if release {
+		operation = "run.release_run"
+		d.ClaimedBy = nil
+		d.ClaimedUntil = nil
+	}
 
 	if d.Terminal() {
 		n := time.Now()
@@ -166,23 +426,43 @@ func (r *Storage) ReleaseRun(ctx context.Context, d *Run) error {
 	}
 
 	updates := map[string]interface{}{
-		"claimed_by":         nil,
-		"claimed_until":      nil,
+		"finished":           d.Finished,
 		"last_step_complete": d.LastStepComplete,
+		"paused":             d.Paused,
 		"data":               d.Data,
 		"state":              d.State,
 		"rollback":           d.Rollback,
+		"version":            d.Version + 1,
+	}
+	if release {
+		updates["claimed_by"] = nil
+		updates["claimed_until"] = nil
 	}
 
-	span, db, ctx := tracing.NewDBSpan(ctx, r.db.Master, "run.release_run")
-	err = db.
-		Model(&d).
-		Where("uuid = ?", d.UUID).
-		Updates(updates).Error
-	span.RecordError(err)
+	span, db, ctx := tracing.NewDBSpan(ctx, r.db.Master, operation)
+	res := db.
+		Table("runs").
+		Where("uuid = ? AND version = ?", d.UUID, d.Version).
+		Updates(updates)
+	span.RecordError(res.Error)
 	span.Finish()
 
-	return err
+	switch {
+	case res.Error != nil:
+		return res.Error
+	case res.RowsAffected == 0:
+		return ErrConflict
+	}
+
+	d.Version++
+
+	// a run that moved forward may be ready to execute, or have made the next
+	// run of its job and scope ready.
+	d.read = d.progress()
+	if moved {
+		notify(ctx, r.db.Master, d, releasedBy)
+	}
+	return nil
 }
 
 func (r *Storage) ClaimedRuns(ctx context.Context) ([]*Run, error) {
@@ -0,0 +1,127 @@
+package run
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotRetryable is returned by Run.Retry when the run hasn't failed.
+var ErrNotRetryable = errors.New("only a failed or errored run can be retried")
+
+// RetryOptions configures Run.Retry.
+type RetryOptions struct {
+	// Input is merged into the input of the run and of the retried steps, so
+	// that input that caused the failure can be corrected.
+	Input InputData
+
+	// ResetAfter also resets every step that follows the retried steps. The
+	// steps that were executed to roll back are always reset, so that they
+	// are executed again if a retried step fails again.
+	ResetAfter bool
+}
+
+// Retry resumes a failed or errored run from the steps that failed along its
+// path. They are reset to StateQueued and the run stops rolling back, and the
+// retry is recorded in the history of the run.
+func (r *Run) Retry(opts RetryOptions, now time.Time) error {
+	if r.State != StateFailed && r.State != StateError {
+		return ErrNotRetryable
+	}
+
+	failing := failingSteps(r.Steps)
+	if len(failing) == 0 {
+		return ErrNotRetryable
+	}
+
+	uuids := make([]string, len(failing))
+	for i, s := range failing {
+		s.reset(opts.Input)
+		if opts.ResetAfter {
+			_, next := edges(s)
+			for _, n := range next {
+				resetFrom(n)
+			}
+		} else {
+			resetFrom(s.OnFailure)
+		}
+		uuids[i] = s.UUID
+	}
+
+	r.History = append(r.History, Event{
+		Type:  EventRetry,
+		Time:  now,
+		State: r.State,
+		Steps: uuids,
+		Input: opts.Input,
+	})
+
+	r.Input = r.Input.Merge(opts.Input)
+	r.Rollback = false
+	r.Finished = nil
+	r.Resolve()
+	return nil
+}
+
+// failingSteps returns the steps that failed along the forward path of the
+// graph starting at s. The compensations of a failed fan-out are dropped, so
+// that they are created again if the retry fails too.
+func failingSteps(s *Step) []*Step {
+	if s == nil {
+		return nil
+	}
+
+	switch s.State {
+	case StateFailed, StateError:
+		return []*Step{s}
+	case StateSuccess:
+		if len(s.Branches) == 0 {
+			return failingSteps(s.Successor())
+		}
+
+		if state, _ := resolveBranches(s, nil); state != StateFailed {
+			return failingSteps(s.Successor())
+		}
+
+		var failing []*Step
+		for _, b := range s.Branches {
+			failing = append(failing, failingSteps(b)...)
+		}
+		s.dropCompensations()
+		return failing
+	}
+	return nil
+}
+
+func resetFrom(s *Step) {
+	if s == nil {
+		return
+	}
+
+	s.reset(nil)
+	_, next := edges(s)
+	for _, n := range next {
+		resetFrom(n)
+	}
+}
+
+// reset queues the step to be executed again with input merged into its
+// input.
+func (s *Step) reset(input InputData) {
+	s.State = StateQueued
+	s.Input = s.Input.Merge(input)
+	s.Output = Result{Data: make(InputData)}
+	s.Attempts = 0
+	s.LastError = ""
+	s.NotBefore = nil
+	s.Started = nil
+	s.Signal = ""
+	s.ChildRun = ""
+	s.dropCompensations()
+}
+
+func (s *Step) dropCompensations() {
+	if s.OnFailure != nil && s.OnFailure.Compensates != "" {
+		s.OnFailure = nil
+	}
+}
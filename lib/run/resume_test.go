@@ -0,0 +1,135 @@
+package run_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun_Retry(t *testing.T) {
+	now := time.Now().UTC()
+
+	// hello failed, so goodbye was executed to roll back and the run failed.
+	rolledBack := func() *run.Run {
+		r := testhelpers.CreateSampleRunFirstStepFailureThenSuccess("job", "s1", run.InputData{"region": "us-east-1"})
+		r.Steps.OnFailure.OnSuccess.State = run.StateSuccess
+		r.Steps.Attempts = 2
+		r.State, r.Rollback = r.ResolveState()
+		return r
+	}
+
+	tests := map[string]struct {
+		run     func() *run.Run
+		opts    run.RetryOptions
+		wantErr error
+	}{
+		"a failed run":                  {rolledBack, run.RetryOptions{}, nil},
+		"a failed run and what follows": {rolledBack, run.RetryOptions{ResetAfter: true}, nil},
+		"with corrected input":          {rolledBack, run.RetryOptions{Input: run.InputData{"region": "eu-west-1"}}, nil},
+		"a queued run": {func() *run.Run {
+			return testhelpers.CreateSampleRun("job", "s1", nil)
+		}, run.RetryOptions{}, run.ErrNotRetryable},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := tc.run()
+			before := r.State
+
+			err := r.Retry(tc.opts, now)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				assert.Empty(t, r.History)
+				return
+			}
+
+			assert.Equal(t, run.StateFailed, before)
+			assert.Equal(t, run.StateQueued, r.State)
+			assert.False(t, r.Rollback)
+			assert.Equal(t, run.StateQueued, r.Steps.State)
+			assert.Equal(t, 0, r.Steps.Attempts)
+			// the rollback is reset either way.
+			assert.Equal(t, run.StateQueued, r.Steps.OnFailure.State)
+			assert.Equal(t, run.StateQueued, r.Steps.OnFailure.OnSuccess.State)
+
+			next, input, err := r.NextStep()
+			assert.Nil(t, err)
+			assert.Equal(t, r.Steps, next)
+			if tc.opts.Input != nil {
+				assert.Equal(t, "eu-west-1", input.UnmarshalString("region"))
+			}
+
+			assert.Equal(t, []run.Event{{
+				Type:  run.EventRetry,
+				Time:  now,
+				State: run.StateFailed,
+				Steps: []string{r.Steps.UUID},
+				Input: tc.opts.Input,
+			}}, r.History)
+		})
+	}
+}
+
+func TestRun_Retry_FailsAgain(t *testing.T) {
+	r := testhelpers.CreateSampleRunFirstStepFailureThenSuccess("job", "s1", nil)
+	r.Steps.OnFailure.OnSuccess.State = run.StateSuccess
+	r.State, r.Rollback = r.ResolveState()
+	assert.Equal(t, run.StateFailed, r.State)
+
+	assert.Nil(t, r.Retry(run.RetryOptions{}, time.Now()))
+	complete(r.Steps, run.StateFailed, nil)
+	r.Resolve()
+
+	// the run rolls back again.
+	assert.Equal(t, run.StateQueued, r.State)
+	assert.True(t, r.Rollback)
+	next, _, err := r.NextStep()
+	assert.Nil(t, err)
+	assert.Equal(t, r.Steps.OnFailure, next)
+}
+
+func TestRun_Retry_FanOut(t *testing.T) {
+	r := testhelpers.CreateSampleFanOutRun("job", "s1", 0, nil)
+	r.Steps.State = run.StateSuccess
+	r.Steps.Branches[0].State = run.StateSuccess
+	r.Steps.Branches[1].Abort("invalid input")
+	r.State, r.Rollback = r.ResolveState()
+	assert.Equal(t, run.StateError, r.State)
+
+	assert.Nil(t, r.Retry(run.RetryOptions{}, time.Now()))
+	assert.Equal(t, run.StateQueued, r.State)
+	assert.Equal(t, run.StateSuccess, r.Steps.Branches[0].State)
+
+	queued, err := r.NextSteps()
+	assert.Nil(t, err)
+	if assert.Len(t, queued, 1) {
+		assert.Equal(t, r.Steps.Branches[1], queued[0].Step)
+	}
+}
+
+func TestRun_Retry_Compensated(t *testing.T) {
+	r := createSagaRun()
+	complete(r.Steps, run.StateSuccess, nil)
+	charge, ship := r.Steps.OnSuccess, r.Steps.OnSuccess.OnSuccess
+	complete(charge, run.StateSuccess, nil)
+	complete(ship, run.StateFailed, nil)
+	r.Resolve()
+	for _, c := range r.Compensations() {
+		complete(c.Step, run.StateSuccess, nil)
+	}
+	r.Resolve()
+	assert.Equal(t, run.StateFailed, r.State)
+
+	// the compensations are created again if the retried step fails again.
+	assert.Nil(t, r.Retry(run.RetryOptions{}, time.Now()))
+	assert.Empty(t, r.Compensations())
+	complete(ship, run.StateFailed, nil)
+	r.Resolve()
+	assert.Len(t, r.Compensations(), 2)
+	assert.Equal(t, run.StateQueued, r.State)
+}
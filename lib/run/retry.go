@@ -0,0 +1,139 @@
+package run
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// DefaultInitialBackoff is the delay before the first retry of a policy that
+// doesn't set an InitialBackoff.
+const DefaultInitialBackoff = time.Second
+
+// DefaultRetryPolicy is applied to the steps that don't declare a policy of
+// their own. They are retried forever, backing off up to a minute between
+// attempts.
+var DefaultRetryPolicy = RetryPolicy{
+	InitialBackoff: Duration(DefaultInitialBackoff),
+	MaxBackoff:     Duration(time.Minute),
+}
+
+// RetryPolicy controls how a step is retried when its Stepper returns an
+// error.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, including the first, before the
+	// step errors. Zero retries forever.
+	MaxAttempts int `json:"max_attempts"`
+
+	// InitialBackoff is the delay before the first retry, or
+	// DefaultInitialBackoff when it's zero. It doubles on every following
+	// attempt up to MaxBackoff, if set.
+	InitialBackoff Duration `json:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff"`
+
+	// Jitter is the fraction, between 0 and 1, of the backoff that is
+	// randomly removed to spread out retries.
+	Jitter float64 `json:"jitter"`
+
+	// RetryOn limits retries to errors with one of these codes. See
+	// StepError. Every error is retryable when it's empty.
+	RetryOn []string `json:"retry_on"`
+}
+
+// Retryable reports whether err should be retried under the policy. A
+// permanent error is never retried.
+func (p *RetryPolicy) Retryable(err error) bool {
+	se := findStepError(err)
+	if se != nil && se.Permanent {
+		return false
+	}
+	if len(p.RetryOn) == 0 {
+		return true
+	}
+	if se == nil {
+		return false
+	}
+
+	for _, code := range p.RetryOn {
+		if se.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Exhausted reports whether no attempts remain after the given number of
+// attempts.
+func (p *RetryPolicy) Exhausted(attempts int) bool {
+	return p.MaxAttempts > 0 && attempts >= p.MaxAttempts
+}
+
+// Backoff returns how long to wait before retrying after the given number of
+// failed attempts.
+func (p *RetryPolicy) Backoff(attempts int) time.Duration {
+	backoff := time.Duration(p.InitialBackoff)
+	if backoff <= 0 {
+		backoff = DefaultInitialBackoff
+	}
+	for i := 1; i < attempts && backoff < math.MaxInt64/2; i++ {
+		backoff *= 2
+	}
+
+	if p.MaxBackoff > 0 && backoff > time.Duration(p.MaxBackoff) {
+		backoff = time.Duration(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		backoff -= time.Duration(rand.Float64() * p.Jitter * float64(backoff))
+	}
+
+	return backoff
+}
+
+// StepError is an error returned by a Stepper that classifies the failure,
+// so that a RetryPolicy can decide whether to retry it without inspecting
+// the message.
+type StepError struct {
+	Code      string
+	Permanent bool // a permanent error is never retried.
+	Err       error
+}
+
+// NewStepError wraps err with the given code, which is matched against the
+// RetryOn of a RetryPolicy.
+func NewStepError(code string, err error) error {
+	return &StepError{Code: code, Err: err}
+}
+
+// Permanent wraps err so that the step errors without being retried.
+func Permanent(err error) error {
+	return &StepError{Permanent: true, Err: err}
+}
+
+func (e *StepError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// findStepError returns the first StepError in the chain of errors wrapped by
+// err, whether they were wrapped with errors.Wrap or fmt.Errorf.
+func findStepError(err error) *StepError {
+	for err != nil {
+		if se, ok := err.(*StepError); ok {
+			return se
+		}
+
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		case interface{ Cause() error }:
+			err = e.Cause()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
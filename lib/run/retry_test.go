@@ -0,0 +1,149 @@
+package run_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := run.RetryPolicy{
+		InitialBackoff: run.Duration(time.Second),
+		MaxBackoff:     run.Duration(5 * time.Second),
+	}
+
+	tests := map[string]struct {
+		attempts int
+		want     time.Duration
+	}{
+		"first retry":       {1, time.Second},
+		"second retry":      {2, 2 * time.Second},
+		"third retry":       {3, 4 * time.Second},
+		"capped at maximum": {4, 5 * time.Second},
+		"many retries":      {100, 5 * time.Second},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, p.Backoff(tc.attempts))
+		})
+	}
+
+	t.Run("without an initial backoff", func(t *testing.T) {
+		assert.Equal(t, run.DefaultInitialBackoff, (&run.RetryPolicy{}).Backoff(1))
+		assert.Equal(t, 2*run.DefaultInitialBackoff, (&run.RetryPolicy{}).Backoff(2))
+	})
+
+	t.Run("with jitter", func(t *testing.T) {
+		p := run.RetryPolicy{InitialBackoff: run.Duration(time.Second), Jitter: 0.5}
+		for i := 0; i < 10; i++ {
+			b := p.Backoff(1)
+			assert.True(t, b > 500*time.Millisecond && b <= time.Second)
+		}
+	})
+}
+
+func TestRetryPolicy_Retryable(t *testing.T) {
+	p := run.RetryPolicy{RetryOn: []string{"timeout", "unavailable"}}
+
+	assert.True(t, p.Retryable(run.NewStepError("timeout", errors.New("request timed out"))))
+	assert.True(t, p.Retryable(pkgerrors.Wrap(run.NewStepError("unavailable", errors.New("got status 503")), "failed to deploy")))
+	assert.True(t, p.Retryable(fmt.Errorf("failed to deploy: %w", run.NewStepError("timeout", errors.New("request timed out")))))
+	assert.False(t, p.Retryable(run.NewStepError("bad_request", errors.New("bad request"))))
+	assert.False(t, p.Retryable(errors.New("request timeout")))
+
+	assert.True(t, (&run.RetryPolicy{}).Retryable(errors.New("anything")))
+	assert.False(t, (&run.RetryPolicy{}).Retryable(run.Permanent(errors.New("bad request"))))
+}
+
+func TestStep_RecordError(t *testing.T) {
+	now := time.Now().UTC()
+	policy := &run.RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: run.Duration(time.Minute),
+		RetryOn:        []string{"flaky"},
+	}
+	flaky := run.NewStepError("flaky", errors.New("flaky"))
+
+	t.Run("without a policy", func(t *testing.T) {
+		s := testhelpers.CreateStep("say_hello")
+		s.RecordError(errors.New("flaky"), now)
+		assert.Equal(t, run.StateQueued, s.State)
+		assert.Equal(t, 1, s.Attempts)
+		assert.Equal(t, "flaky", s.LastError)
+		assert.Equal(t, now.Add(run.DefaultInitialBackoff), *s.NotBefore)
+
+		s.RecordError(run.Permanent(errors.New("bad request")), now)
+		assert.Equal(t, run.StateError, s.State)
+	})
+
+	t.Run("with attempts remaining", func(t *testing.T) {
+		s := testhelpers.CreateStep("say_hello")
+		s.Retry = policy
+		s.RecordError(flaky, now)
+		assert.Equal(t, run.StateQueued, s.State)
+		assert.Equal(t, now.Add(time.Minute), *s.NotBefore)
+		assert.False(t, s.Eligible(now))
+		assert.True(t, s.Eligible(now.Add(time.Minute)))
+	})
+
+	t.Run("with attempts exhausted", func(t *testing.T) {
+		s := testhelpers.CreateStep("say_hello")
+		s.Retry = policy
+		s.RecordError(flaky, now)
+		s.RecordError(flaky, now)
+		assert.Equal(t, run.StateError, s.State)
+		assert.Equal(t, 2, s.Attempts)
+		assert.Nil(t, s.NotBefore)
+		assert.NotEmpty(t, s.Output.Error)
+	})
+
+	t.Run("with an error that is not retryable", func(t *testing.T) {
+		s := testhelpers.CreateStep("say_hello")
+		s.Retry = policy
+		s.RecordError(errors.New("bad request"), now)
+		assert.Equal(t, run.StateError, s.State)
+	})
+}
+
+func TestRun_Eligible(t *testing.T) {
+	now := time.Now().UTC()
+	later := now.Add(time.Minute)
+
+	r := testhelpers.CreateSampleFanOutRun("job", "s1", 0, nil)
+	r.Steps.State = run.StateSuccess
+	r.Steps.Branches[0].NotBefore = &later
+	assert.True(t, r.Eligible(now))
+
+	queued, err := r.NextSteps()
+	assert.Nil(t, err)
+	assert.Len(t, queued, 1)
+	assert.Equal(t, "say_goodbye2", queued[0].Step.StepType)
+
+	r.Steps.Branches[1].NotBefore = &later
+	assert.False(t, r.Eligible(now))
+	assert.True(t, r.Eligible(later))
+}
+
+func TestDuration_JSON(t *testing.T) {
+	var p run.RetryPolicy
+	assert.Nil(t, json.Unmarshal([]byte(`{"initial_backoff": "1m30s", "max_backoff": 1000000000}`), &p))
+	assert.Equal(t, run.Duration(90*time.Second), p.InitialBackoff)
+	assert.Equal(t, run.Duration(time.Second), p.MaxBackoff)
+
+	b, err := json.Marshal(p.InitialBackoff)
+	assert.Nil(t, err)
+	assert.Equal(t, `"1m30s"`, string(b))
+
+	assert.NotNil(t, json.Unmarshal([]byte(`{"initial_backoff": "soon"}`), &p))
+}
@@ -8,19 +8,27 @@ import (
 )
 
 var ErrNoQueuedSteps = errors.New("failed to find queued step")
+var ErrNotCancelable = errors.New("a finished run can't be canceled")
 
 // Trigger is something that kicks off a Run.
 type Trigger struct {
-	JobName string
-	Scope   string
-	Input   InputData // input from the trigger source (API data, webhook, etc).
+	JobName    string
+	Scope      string
+	Input      InputData // input from the trigger source (API data, webhook, etc).
+	ParentUUID string    // uuid of the run that launched this one, if any.
+
+	// RunAt, or else Delay from now, is when the run should start. The run
+	// stays dormant until then.
+	RunAt *time.Time
+	Delay time.Duration
 }
 
 // Run is an instantiation of a Job.
 type Run struct {
-	Input InputData       `sql:"-"`
-	Steps *Step           `sql:"-"`
-	Data  json.RawMessage `gorm:"type:jsonb;"`
+	Input   InputData       `sql:"-"`
+	Steps   *Step           `sql:"-"`
+	History []Event         `sql:"-"`
+	Data    json.RawMessage `gorm:"type:jsonb;"`
 
 	JobName  string
 	Rollback bool
@@ -32,13 +40,46 @@ type Run struct {
 	Finished         *time.Time
 	LastStepComplete *time.Time
 	ClaimedUntil     *time.Time
-	ClaimedBy        *string // uuid of worker, if claimed
+	ClaimedBy        *string    // uuid of worker, if claimed
+	ParentUUID       *string    // uuid of the run that launched this one, if any
+	NotBefore        *time.Time // the run is dormant until this time, if set
+	Paused           bool       // a paused run isn't claimed until it's resumed
+
+	// Version is incremented every time the run is claimed or released, so
+	// that a write based on a stale copy of the run fails with ErrConflict.
+	Version int
+
+	// read is the progress of the run when it was last read or written.
+	read progress
+}
+
+// progress is what makes a run, or the next run of its job and scope, ready
+// to execute when it changes.
+type progress struct {
+	state            State
+	lastStepComplete int64
+	paused           bool
+}
+
+func (r *Run) progress() progress {
+	p := progress{state: r.State, paused: r.Paused}
+	if r.LastStepComplete != nil {
+		p.lastStepComplete = r.LastStepComplete.UnixNano()
+	}
+	return p
+}
+
+// AfterFind is called by gorm once the run has been read.
+func (r *Run) AfterFind() error {
+	r.read = r.progress()
+	return nil
 }
 
 func (r *Run) MarshalRunData() error {
 	rd := Data{
-		Input: r.Input,
-		Steps: r.Steps,
+		Input:   r.Input,
+		Steps:   r.Steps,
+		History: r.History,
 	}
 	var err error
 	r.Data, err = json.Marshal(&rd)
@@ -53,6 +94,7 @@ func (r *Run) UnmarshalRunData() error {
 	}
 	r.Input = rd.Input
 	r.Steps = rd.Steps
+	r.History = rd.History
 
 	return nil
 }
@@ -62,9 +104,10 @@ func (r *Run) Terminal() bool {
 }
 
 type Data struct {
-	Input InputData `json:"input"`
-	Steps *Step     `json:"step"`
-	Job   Job       `json:"job"`
+	Input   InputData `json:"input"`
+	Steps   *Step     `json:"step"`
+	Job     Job       `json:"job"`
+	History []Event   `json:"history,omitempty"`
 }
 
 func NewRun(j Job, trigger Trigger) *Run {
@@ -72,7 +115,7 @@ func NewRun(j Job, trigger Trigger) *Run {
 	steps := generateGraphFromStepTemplate(j.Start)
 	steps.State = StateQueued
 
-	return &Run{
+	r := &Run{
 		Input:   trigger.Input,
 		JobName: j.Name,
 		Scope:   trigger.Scope,
@@ -80,32 +123,136 @@ func NewRun(j Job, trigger Trigger) *Run {
 		UUID:    id,
 		Steps:   steps,
 	}
+	if trigger.ParentUUID != "" {
+		r.ParentUUID = &trigger.ParentUUID
+	}
+
+	switch {
+	case trigger.RunAt != nil:
+		at := trigger.RunAt.UTC()
+		r.NotBefore = &at
+	case trigger.Delay > 0:
+		at := time.Now().UTC().Add(trigger.Delay)
+		r.NotBefore = &at
+	}
+
+	return r
 }
 
+// Dormant reports whether the run is waiting for its NotBefore time at now.
+// A dormant run is not executed, and does not hold up the other runs of its
+// job and scope.
+func (r *Run) Dormant(now time.Time) bool {
+	return r.NotBefore != nil && now.Before(*r.NotBefore)
+}
+
+// QueuedStep is a step that is ready to be executed along with the input it
+// should be executed with.
+type QueuedStep struct {
+	Step  *Step
+	Input InputData
+}
+
+// NextStep returns the first step of the run that is ready to be executed.
 func (r *Run) NextStep() (*Step, InputData, error) {
-	firstQueued, data, err := findFirstQueuedStepAndHydrateInput(r.Steps, r.Input)
+	queued, err := r.NextSteps()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	if firstQueued == nil {
+	if len(queued) == 0 {
 		return nil, nil, nil
 	}
 
-	// inject relevant data before this step is executed.
-	data["step_uuid"] = firstQueued.UUID
-	data["run_uuid"] = r.UUID
+	return queued[0].Step, queued[0].Input, nil
+}
+
+// NextSteps returns every step of the run that is ready to be executed. There
+// is more than one when the run is executing the branches of a fan-out step.
+// Steps that are waiting to be retried are not included.
+func (r *Run) NextSteps() ([]QueuedStep, error) {
+	queued, err := findQueuedStepsAndHydrateInput(r.Steps, r.Input)
+	if err != nil {
+		return nil, err
+	}
 
-	return firstQueued, data, nil
+	now := time.Now().UTC()
+	var eligible []QueuedStep
+	for _, q := range queued {
+		if !q.Step.Eligible(now) {
+			continue
+		}
+
+		// inject relevant data before this step is executed.
+		q.Input["step_uuid"] = q.Step.UUID
+		q.Input["run_uuid"] = r.UUID
+		eligible = append(eligible, q)
+	}
+
+	return eligible, nil
+}
+
+// Eligible reports whether the run can be executed at the given time. It is
+// not eligible when every one of its queued steps is waiting to be retried.
+func (r *Run) Eligible(now time.Time) bool {
+	queued, err := findQueuedStepsAndHydrateInput(r.Steps, r.Input)
+	if err != nil || len(queued) == 0 {
+		return true
+	}
+
+	for _, q := range queued {
+		if q.Step.Eligible(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parked reports whether every one of the queued steps of the run is parked,
+// waiting on a sleep, a signal or an approval, at the given time. A run
+// waiting to retry a step isn't parked.
+func (r *Run) Parked(now time.Time) bool {
+	queued, err := findQueuedStepsAndHydrateInput(r.Steps, r.Input)
+	if err != nil || len(queued) == 0 {
+		return false
+	}
+
+	for _, q := range queued {
+		if !q.Step.Parked() || q.Step.Eligible(now) {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolveState calculates the state of the run, and whether it is rolling
+// back, from the state of its steps.
+func (r *Run) ResolveState() (State, bool) {
+	state, rollback, _ := resolve(r.Steps, r.Rollback, r.Input)
+	if state == StateFailed && r.compensationFailed() {
+		state = StateError
+	}
+	return state, rollback
+}
+
+// Output returns the output of every step that has executed along the path the
+// run has taken, merged together.
+func (r *Run) Output() InputData {
+	_, _, d := resolve(r.Steps, r.Rollback, make(InputData))
+	return d
 }
 
 func (r *Run) Fail(m string) {
 	r.Rollback = true
-	if curStep := r.CurrentStep(); curStep != nil {
-		curStep.Fail(m)
-	} else {
+	current := r.CurrentSteps()
+	if len(current) == 0 {
 		// if there is no next state, we've reached an error state
 		r.State = StateError
+		return
+	}
+
+	for _, s := range current {
+		s.Fail(m)
 	}
 }
 
@@ -113,51 +260,212 @@ func (r *Run) Abort() {
 	r.State = StateError
 }
 
+// Cancel stops the run: every step it is currently on is failed with m and
+// the run is moved into the error state without rolling back. A run that has
+// finished can't be canceled.
+func (r *Run) Cancel(m string) error {
+	if r.Terminal() {
+		return ErrNotCancelable
+	}
+
+	for _, s := range r.CurrentSteps() {
+		s.Fail(m)
+	}
+	r.Abort()
+	return nil
+}
+
+// TimeoutSteps fails every step the run is currently on that has run past its
+// Timeout at now, and resolves the state of the run. It returns whether any
+// step timed out.
+func (r *Run) TimeoutSteps(now time.Time) bool {
+	var timedOut bool
+	for _, s := range r.CurrentSteps() {
+		if s.TimedOut(now) {
+			s.Fail(TimeoutMessage(time.Duration(s.Timeout)))
+			timedOut = true
+		}
+	}
+
+	if timedOut {
+		r.LastStepComplete = &now
+		r.Resolve()
+	}
+	return timedOut
+}
+
+// FindStep returns the step of the run with the given uuid, or nil if there
+// is no such step.
+func (r *Run) FindStep(uuid string) *Step {
+	return findStep(r.Steps, uuid)
+}
+
+func findStep(s *Step, uuid string) *Step {
+	if s == nil {
+		return nil
+	}
+
+	if s.UUID == uuid {
+		return s
+	}
+
+	_, next := edges(s)
+	for _, n := range next {
+		if found := findStep(n, uuid); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Children returns the uuids of the runs launched by the steps of the run.
+func (r *Run) Children() []string {
+	var children []string
+	walkSteps(r.Steps, func(s *Step) {
+		if s.ChildRun != "" {
+			children = append(children, s.ChildRun)
+		}
+	})
+	return children
+}
+
+func walkSteps(s *Step, f func(*Step)) {
+	if s == nil {
+		return
+	}
+
+	f(s)
+	_, next := edges(s)
+	for _, n := range next {
+		walkSteps(n, f)
+	}
+}
+
+// CurrentStep returns the first of the steps the run is currently on.
 func (r *Run) CurrentStep() *Step {
-	return findCurrentStep(r.Steps)
+	current := r.CurrentSteps()
+	if len(current) == 0 {
+		return nil
+	}
+	return current[0]
+}
+
+// CurrentSteps returns every step the run is currently on. Once the run has
+// completed, these are the last steps that were executed.
+func (r *Run) CurrentSteps() []*Step {
+	return findCurrentSteps(r.Steps)
 }
 
-func findFirstQueuedStepAndHydrateInput(s *Step, d InputData) (*Step, InputData, error) {
+func findQueuedStepsAndHydrateInput(s *Step, d InputData) ([]QueuedStep, error) {
 	if s == nil {
-		return nil, nil, nil
+		return nil, nil
+	}
+
+	switch s.State {
+	case StateQueued:
+		return []QueuedStep{{Step: s, Input: d.Merge(s.Input).Merge(s.Output.Data)}}, nil
+	case StateSuccess:
+		if len(s.Branches) > 0 {
+			return findQueuedBranchStepsAndHydrateInput(s, d.Merge(s.Output.Data))
+		}
+		return findQueuedStepsAndHydrateInput(s.Successor(), d.Merge(s.Output.Data))
+	case StateFailed:
+		return findQueuedStepsAndHydrateInput(s.OnFailure, d.Merge(s.Output.Data))
+	case StateError:
+		if compensating(s) {
+			return findQueuedStepsAndHydrateInput(s.OnFailure, d.Merge(s.Output.Data))
+		}
 	}
 
-	if s.State == StateQueued {
-		return s, d.Merge(s.Input).Merge(s.Output.Data), nil
+	return nil, ErrNoQueuedSteps
+}
+
+func findQueuedBranchStepsAndHydrateInput(s *Step, d InputData) ([]QueuedStep, error) {
+	var queued []QueuedStep
+	for _, b := range s.Branches {
+		// a branch that has errored simply counts against the quorum.
+		bq, err := findQueuedStepsAndHydrateInput(b, d)
+		if err != nil && err != ErrNoQueuedSteps {
+			return nil, err
+		}
+		queued = append(queued, bq...)
 	}
 
-	if s.State == StateSuccess {
-		return findFirstQueuedStepAndHydrateInput(s.OnSuccess, d.Merge(s.Output.Data))
+	state, data := resolveBranches(s, d)
+	var next *Step
+	switch state {
+	case StateSuccess:
+		next = s.Successor()
+	case StateFailed:
+		next = s.OnFailure
+	default:
+		return queued, nil
 	}
 
-	if s.State == StateFailed {
-		return findFirstQueuedStepAndHydrateInput(s.OnFailure, d.Merge(s.Output.Data))
+	nq, err := findQueuedStepsAndHydrateInput(next, data)
+	if err != nil && len(queued) == 0 {
+		return nil, err
 	}
 
-	return nil, nil, ErrNoQueuedSteps
+	return append(queued, nq...), nil
 }
 
-func findCurrentStep(s *Step) *Step {
+func findCurrentSteps(s *Step) []*Step {
 	if s == nil {
 		return nil
 	}
 
 	switch s.State {
-	case StateQueued, StateError:
-		return s
+	case StateQueued:
+		return []*Step{s}
+	case StateError:
+		if compensating(s) {
+			return findCurrentStepsOrSelf(s, s.OnFailure)
+		}
+		return []*Step{s}
 	case StateSuccess:
-		last := findCurrentStep(s.OnSuccess)
-		if last == nil {
-			last = s
+		if len(s.Branches) > 0 {
+			return findCurrentBranchSteps(s)
 		}
-		return last
+		return findCurrentStepsOrSelf(s, s.Successor())
 	case StateFailed:
-		last := findCurrentStep(s.OnFailure)
-		if last == nil {
-			last = s
-		}
-		return last
+		return findCurrentStepsOrSelf(s, s.OnFailure)
 	}
 
 	return nil
 }
+
+func findCurrentStepsOrSelf(s, next *Step) []*Step {
+	current := findCurrentSteps(next)
+	if len(current) == 0 {
+		return []*Step{s}
+	}
+	return current
+}
+
+func findCurrentBranchSteps(s *Step) []*Step {
+	var current, last []*Step
+	for _, b := range s.Branches {
+		for _, c := range findCurrentSteps(b) {
+			if c.State == StateQueued || c.State == StateError {
+				current = append(current, c)
+			} else {
+				last = append(last, c)
+			}
+		}
+	}
+
+	state, _ := resolveBranches(s, nil)
+	switch state {
+	case StateSuccess:
+		current = append(current, findCurrentSteps(s.Successor())...)
+	case StateFailed:
+		current = append(current, findCurrentSteps(s.OnFailure)...)
+	}
+
+	// every branch has completed and there was nothing to join them to.
+	if len(current) == 0 {
+		return last
+	}
+	return current
+}
@@ -1,7 +1,9 @@
 package run_test
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/mitchfriedman/workflow/lib/run"
 	"github.com/mitchfriedman/workflow/lib/testhelpers"
@@ -168,3 +170,311 @@ func TestNextStep(t *testing.T) {
 		})
 	}
 }
+
+func TestNextSteps_FanOut(t *testing.T) {
+	stepTypes := func(queued []run.QueuedStep) []string {
+		types := []string{}
+		for _, q := range queued {
+			types = append(types, q.Step.StepType)
+		}
+		return types
+	}
+
+	notStarted := testhelpers.CreateSampleFanOutRun("job", "s1", 0, nil)
+
+	branching := testhelpers.CreateSampleFanOutRun("job", "s1", 0, nil)
+	branching.Steps.State = run.StateSuccess
+
+	oneBranchDone := testhelpers.CreateSampleFanOutRun("job", "s1", 0, nil)
+	oneBranchDone.Steps.State = run.StateSuccess
+	oneBranchDone.Steps.Branches[0].State = run.StateSuccess
+
+	joining := testhelpers.CreateSampleFanOutRun("job", "s1", 0, nil)
+	joining.Steps.State = run.StateSuccess
+	joining.Steps.Branches[0].State = run.StateSuccess
+	joining.Steps.Branches[0].Output = testhelpers.CreateSampleResultWithOutput(run.StateSuccess, "region1", "done")
+	joining.Steps.Branches[1].State = run.StateSuccess
+	joining.Steps.Branches[1].Output = testhelpers.CreateSampleResultWithOutput(run.StateSuccess, "region2", "done")
+
+	quorumMet := testhelpers.CreateSampleFanOutRun("job", "s1", 1, nil)
+	quorumMet.Steps.State = run.StateSuccess
+	quorumMet.Steps.Branches[0].State = run.StateSuccess
+
+	quorumMissed := testhelpers.CreateSampleFanOutRun("job", "s1", 0, nil)
+	quorumMissed.Steps.State = run.StateSuccess
+	quorumMissed.Steps.Branches[0].State = run.StateFailed
+
+	tests := map[string]struct {
+		run       *run.Run
+		wantTypes []string
+	}{
+		"not started":                {notStarted, []string{"say_hello"}},
+		"executing all branches":     {branching, []string{"say_goodbye1", "say_goodbye2"}},
+		"executing remaining branch": {oneBranchDone, []string{"say_goodbye2"}},
+		"joining after all branches": {joining, []string{"ask_question"}},
+		"joining once quorum is met": {quorumMet, []string{"say_goodbye2", "ask_question"}},
+		"quorum can not be met":      {quorumMissed, []string{"say_goodbye2"}},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			queued, err := tc.run.NextSteps()
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantTypes, stepTypes(queued))
+			for _, q := range queued {
+				assert.Equal(t, q.Step.UUID, q.Input["step_uuid"])
+			}
+		})
+	}
+
+	t.Run("join receives the output of every branch", func(t *testing.T) {
+		_, data, err := joining.NextStep()
+		assert.Nil(t, err)
+		assert.Equal(t, "done", data["region1"])
+		assert.Equal(t, "done", data["region2"])
+	})
+}
+
+func TestResolveState(t *testing.T) {
+	branching := testhelpers.CreateSampleFanOutRun("job", "s1", 0, nil)
+	branching.Steps.State = run.StateSuccess
+	branching.Steps.Branches[0].State = run.StateSuccess
+
+	joined := testhelpers.CreateSampleFanOutRun("job", "s1", 0, nil)
+	joined.Steps.State = run.StateSuccess
+	joined.Steps.Branches[0].State = run.StateSuccess
+	joined.Steps.Branches[1].State = run.StateSuccess
+	joined.Steps.OnSuccess.State = run.StateSuccess
+
+	branchFailed := testhelpers.CreateSampleFanOutRun("job", "s1", 0, nil)
+	branchFailed.Steps.State = run.StateSuccess
+	branchFailed.Steps.Branches[0].State = run.StateSuccess
+	branchFailed.Steps.Branches[1].State = run.StateFailed
+
+	rolledBack := testhelpers.CreateSampleRunFirstStepFailureThenSuccess("job", "s1", nil)
+	rolledBack.Steps.OnFailure.OnSuccess.State = run.StateSuccess
+
+	tests := map[string]struct {
+		run          *run.Run
+		wantState    run.State
+		wantRollback bool
+	}{
+		"not started":              {testhelpers.CreateSampleRun("job", "s1", nil), run.StateQueued, false},
+		"rolling back":             {testhelpers.CreateSampleRunFirstStepFailure("job", "s1", nil), run.StateQueued, true},
+		"rolled back":              {rolledBack, run.StateFailed, true},
+		"waiting on a branch":      {branching, run.StateQueued, false},
+		"joined after branches":    {joined, run.StateSuccess, false},
+		"branch failed, no quorum": {branchFailed, run.StateError, false},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			state, rollback := tc.run.ResolveState()
+			assert.Equal(t, tc.wantState, state)
+			assert.Equal(t, tc.wantRollback, rollback)
+		})
+	}
+}
+
+func TestNextStep_Outcomes(t *testing.T) {
+	withOutcome := func(outcome string) *run.Run {
+		r := testhelpers.CreateSampleOutcomeRun("job", "s1", nil)
+		r.Steps.State = run.StateSuccess
+		r.Steps.Output = testhelpers.CreateSampleResultWithOutput(run.StateSuccess, run.OutcomeKey, outcome)
+		return r
+	}
+
+	noOutcome := testhelpers.CreateSampleOutcomeRun("job", "s1", nil)
+	noOutcome.Steps.State = run.StateSuccess
+
+	tests := map[string]struct {
+		run      *run.Run
+		wantStep string
+	}{
+		"routes to the matching outcome":          {withOutcome("yes"), "say_goodbye1"},
+		"routes to another matching outcome":      {withOutcome("no"), "say_goodbye2"},
+		"falls back to OnSuccess with no route":   {withOutcome("maybe"), "say_hello"},
+		"falls back to OnSuccess with no outcome": {noOutcome, "say_hello"},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			s, data, err := tc.run.NextStep()
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantStep, s.StepType)
+			assert.Equal(t, s.UUID, data["step_uuid"])
+
+			state, _ := tc.run.ResolveState()
+			assert.Equal(t, run.StateQueued, state)
+		})
+	}
+}
+
+func TestNewRun_Dormant(t *testing.T) {
+	now := time.Now().UTC()
+	at := now.Add(24 * time.Hour)
+	j := run.NewJob("job", testhelpers.CreateSampleRun("job", "s1", nil).Steps)
+
+	tests := map[string]struct {
+		trigger     run.Trigger
+		wantDormant bool
+	}{
+		"immediately":       {run.Trigger{JobName: "job"}, false},
+		"at a time":         {run.Trigger{JobName: "job", RunAt: &at}, true},
+		"at a time in past": {run.Trigger{JobName: "job", RunAt: &now}, false},
+		"after a delay":     {run.Trigger{JobName: "job", Delay: time.Hour}, true},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := run.NewRun(j, tc.trigger)
+			assert.Equal(t, tc.wantDormant, r.Dormant(time.Now().UTC()))
+			assert.False(t, r.Dormant(now.Add(48*time.Hour)))
+		})
+	}
+}
+
+func TestRun_TimeoutSteps(t *testing.T) {
+	now := time.Now().UTC()
+	started := now.Add(-2 * time.Minute)
+
+	tests := map[string]struct {
+		timeout      run.Duration
+		started      *time.Time
+		wantTimedOut bool
+	}{
+		"without a timeout":  {0, &started, false},
+		"not started":        {run.Duration(time.Minute), nil, false},
+		"within the timeout": {run.Duration(time.Hour), &started, false},
+		"past the timeout":   {run.Duration(time.Minute), &started, true},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := testhelpers.CreateSampleRun("job", "s1", nil)
+			r.Steps.Timeout = tc.timeout
+			r.Steps.Started = tc.started
+
+			assert.Equal(t, tc.wantTimedOut, r.TimeoutSteps(now))
+			if !tc.wantTimedOut {
+				assert.Equal(t, run.StateQueued, r.Steps.State)
+				return
+			}
+
+			assert.Equal(t, run.StateFailed, r.Steps.State)
+			assert.Equal(t, "step timed out after 1m0s", r.Steps.Output.Data.UnmarshalString("failure_message"))
+			assert.Equal(t, run.StateQueued, r.State)
+			assert.True(t, r.Rollback)
+			assert.Equal(t, r.Steps.OnFailure, r.CurrentStep())
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	repo := testhelpers.NewMemoryRepo()
+	r := testhelpers.CreateSampleRun("job", "s1", nil)
+	assert.Nil(t, repo.CreateRun(ctx, r))
+
+	stale, err := repo.GetRun(ctx, r.UUID)
+	assert.Nil(t, err)
+
+	fresh, err := repo.GetRun(ctx, r.UUID)
+	assert.Nil(t, err)
+	fresh.Rollback = true
+	assert.Nil(t, repo.ReleaseRun(ctx, fresh))
+
+	// a stale copy can't be written.
+	assert.Equal(t, run.ErrConflict, repo.ReleaseRun(ctx, stale))
+
+	var calls int
+	updated, err := run.Update(ctx, repo, stale, func(r *run.Run) error {
+		calls++
+		return r.Cancel("canceled by user")
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, run.StateError, updated.State)
+	assert.True(t, updated.Rollback)
+
+	found, err := repo.GetRun(ctx, r.UUID)
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateError, found.State)
+	assert.Equal(t, run.StateFailed, found.Steps.State)
+	assert.Equal(t, updated.Version, found.Version)
+}
+
+// laggingRepo reads runs from a replica that never catches up.
+type laggingRepo struct {
+	*testhelpers.MemoryRepo
+	stale *run.Run
+}
+
+func (r *laggingRepo) GetRun(ctx context.Context, uuid string) (*run.Run, error) {
+	return r.stale, nil
+}
+
+func TestUpdate_ReadsLatestRun(t *testing.T) {
+	ctx := context.Background()
+	memory := testhelpers.NewMemoryRepo()
+	r := testhelpers.CreateSampleRun("job", "s1", nil)
+	assert.Nil(t, memory.CreateRun(ctx, r))
+
+	stale, err := memory.GetRun(ctx, r.UUID)
+	assert.Nil(t, err)
+	fresh, err := memory.GetRun(ctx, r.UUID)
+	assert.Nil(t, err)
+	assert.Nil(t, memory.ReleaseRun(ctx, fresh))
+
+	repo := &laggingRepo{MemoryRepo: memory, stale: stale}
+	updated, err := run.Update(ctx, repo, stale, func(r *run.Run) error {
+		return r.Cancel("canceled by user")
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateError, updated.State)
+}
+
+func TestModify(t *testing.T) {
+	ctx := context.Background()
+	repo := testhelpers.NewMemoryRepo()
+	r := testhelpers.CreateSampleRun("job", "s1", nil)
+	assert.Nil(t, repo.CreateRun(ctx, r))
+	assert.Nil(t, repo.ClaimRun(ctx, r, "worker-1", time.Minute))
+
+	found, err := repo.GetRun(ctx, r.UUID)
+	assert.Nil(t, err)
+	modified, err := run.Modify(ctx, repo, found, func(r *run.Run) error {
+		return r.Cancel("canceled by user")
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateError, modified.State)
+
+	// the worker executing the run keeps its claim until it notices.
+	found, err = repo.GetRun(ctx, r.UUID)
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateError, found.State)
+	if assert.NotNil(t, found.ClaimedBy) {
+		assert.Equal(t, "worker-1", *found.ClaimedBy)
+	}
+	assert.NotNil(t, found.ClaimedUntil)
+	assert.NotNil(t, found.Finished)
+}
+
+func TestRun_Cancel(t *testing.T) {
+	r := testhelpers.CreateSampleRunFirstStepSuccess("job", "s1", nil)
+	assert.Nil(t, r.Cancel("canceled by user"))
+	assert.Equal(t, run.StateError, r.State)
+	assert.Equal(t, run.StateFailed, r.Steps.OnSuccess.State)
+
+	// a finished run keeps its outcome.
+	finished := testhelpers.CreateSampleRunFirst2StepsSuccess("job", "s1", nil)
+	finished.State = run.StateSuccess
+	assert.Equal(t, run.ErrNotCancelable, finished.Cancel("canceled by user"))
+	assert.Equal(t, run.StateSuccess, finished.State)
+	assert.Equal(t, run.StateSuccess, finished.Steps.OnSuccess.State)
+}
@@ -0,0 +1,106 @@
+package run
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SignalStepperType is the step type of the SignalStepper.
+const SignalStepperType = "wait_for_signal"
+
+const (
+	signalNameKey    = "signal"
+	signalTimeoutKey = "signal_timeout"
+	awaitingStepKey  = "awaiting_step_uuid"
+)
+
+// ErrNoSignalWaiter is returned by Run.Signal when none of the steps the run
+// is currently on is waiting for the signal.
+var ErrNoSignalWaiter = errors.New("no step is waiting for the signal")
+
+// AwaitSignal returns the Result of a step that waits for the signal name to
+// be delivered with Run.Signal. The step stays queued and the run is released
+// in the meantime. If deadline is set and passes before the signal is
+// delivered, the step is executed again.
+func AwaitSignal(name string, deadline *time.Time, d InputData) Result {
+	if deadline != nil {
+		at := deadline.UTC()
+		deadline = &at
+	}
+	return Result{State: StateQueued, Data: d, Signal: name, WakeAt: deadline}
+}
+
+// Signal delivers the signal name to the steps of the run that are waiting
+// for it. The payload is merged into their output and they succeed, so that
+// the run resumes.
+func (r *Run) Signal(name string, payload InputData, now time.Time) error {
+	// approvals are decided with Decide, which checks the approver.
+	if name == approvalSignal {
+		return ErrNoSignalWaiter
+	}
+
+	var delivered bool
+	for _, s := range r.CurrentSteps() {
+		if s.State != StateQueued || s.Signal != name {
+			continue
+		}
+
+		s.State = StateSuccess
+		s.Signal = ""
+		s.NotBefore = nil
+		s.Output = Result{
+			State: StateSuccess,
+			Data:  s.Output.Data.Merge(payload),
+		}
+		delivered = true
+	}
+
+	if !delivered {
+		return ErrNoSignalWaiter
+	}
+
+	r.LastStepComplete = &now
+	r.Resolve()
+	return nil
+}
+
+// SignalStepper is a Stepper that waits for the signal named in its input to
+// be delivered, such as by a CI system calling back. The step fails if the
+// optional signal_timeout passes first, so that OnFailure is executed.
+type SignalStepper struct{}
+
+func NewSignalStepper() *SignalStepper {
+	return &SignalStepper{}
+}
+
+func (s *SignalStepper) Type() string {
+	return SignalStepperType
+}
+
+func (s *SignalStepper) RequiredInput() []Input {
+	return []Input{
+		{Name: signalNameKey, Type: InputTypeString},
+		{Name: signalTimeoutKey, Type: InputTypeDuration, Optional: true},
+	}
+}
+
+func (s *SignalStepper) Step(d InputData) (Result, error) {
+	name := d.UnmarshalString(signalNameKey)
+
+	// the step is only executed again once its timeout has passed.
+	stepUUID := d.UnmarshalString("step_uuid")
+	if d.UnmarshalString(awaitingStepKey) == stepUUID {
+		m := fmt.Sprintf("timed out waiting for signal %q", name)
+		return Result{State: StateFailed, Data: InputData{failureMessage: m}, Error: m}, nil
+	}
+
+	var deadline *time.Time
+	if timeout := toDuration(d[signalTimeoutKey]); timeout > 0 {
+		at := time.Now().UTC().Add(timeout)
+		deadline = &at
+	}
+
+	return AwaitSignal(name, deadline, InputData{awaitingStepKey: stepUUID}), nil
+}
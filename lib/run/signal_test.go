@@ -0,0 +1,95 @@
+package run_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun_Signal(t *testing.T) {
+	now := time.Now().UTC()
+
+	tests := map[string]struct {
+		waitingFor string
+		signal     string
+		wantErr    error
+	}{
+		"waiting for the signal":     {"approved", "approved", nil},
+		"waiting for another signal": {"approved", "rejected", run.ErrNoSignalWaiter},
+		"not waiting for a signal":   {"", "approved", run.ErrNoSignalWaiter},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := testhelpers.CreateSampleRun("job", "s1", nil)
+			r.Steps.Signal = tc.waitingFor
+
+			err := r.Signal(tc.signal, run.InputData{"build": "b-1"}, now)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				assert.Equal(t, run.StateQueued, r.Steps.State)
+				return
+			}
+
+			assert.Equal(t, run.StateSuccess, r.Steps.State)
+			assert.Equal(t, "b-1", r.Steps.Output.Data.UnmarshalString("build"))
+			assert.Equal(t, "", r.Steps.Signal)
+			assert.Equal(t, &now, r.LastStepComplete)
+			assert.Equal(t, run.StateQueued, r.State)
+			assert.Equal(t, r.Steps.OnSuccess, r.CurrentStep())
+		})
+	}
+}
+
+func TestSignalStepper(t *testing.T) {
+	s := run.NewSignalStepper()
+
+	res, err := s.Step(run.InputData{"step_uuid": "ST-1", "signal": "approved"})
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateQueued, res.State)
+	assert.Equal(t, "approved", res.Signal)
+	assert.Nil(t, res.WakeAt)
+
+	res, err = s.Step(run.InputData{"step_uuid": "ST-1", "signal": "approved", "signal_timeout": "1h"})
+	assert.Nil(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *res.WakeAt, time.Minute)
+
+	// the step is executed again once the timeout passes without the signal.
+	res, err = s.Step(run.InputData{"step_uuid": "ST-1", "signal": "approved"}.Merge(res.Data))
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateFailed, res.State)
+	assert.Equal(t, `timed out waiting for signal "approved"`, res.Error)
+}
+
+func TestStep_Eligible(t *testing.T) {
+	now := time.Now().UTC()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	tests := map[string]struct {
+		notBefore *time.Time
+		signal    string
+		want      bool
+	}{
+		"ready":                           {nil, "", true},
+		"waiting to retry":                {&future, "", false},
+		"done waiting to retry":           {&past, "", true},
+		"waiting for a signal":            {nil, "approved", false},
+		"waiting for a signal until late": {&future, "approved", false},
+		"timed out waiting for a signal":  {&past, "approved", true},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			s := testhelpers.CreateStep("say_hello")
+			s.NotBefore = tc.notBefore
+			s.Signal = tc.signal
+			assert.Equal(t, tc.want, s.Eligible(now))
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package run
+
+import (
+	"time"
+)
+
+// SleepStepperType is the step type of the SleepStepper.
+const SleepStepperType = "sleep"
+
+const (
+	sleepDurationKey = "duration"
+	sleepingStepKey  = "sleeping_step_uuid"
+	sleptUntilKey    = "slept_until"
+)
+
+// Sleep returns the Result of a step that should be executed again at until.
+// The step stays queued and the run is released in the meantime, so that it
+// doesn't hold a worker while it waits.
+func Sleep(until time.Time, d InputData) Result {
+	until = until.UTC()
+	return Result{State: StateQueued, Data: d, WakeAt: &until}
+}
+
+// SleepStepper is a Stepper that waits for the duration in its input before
+// succeeding, such as for the bake time between the stages of a canary.
+type SleepStepper struct{}
+
+func NewSleepStepper() *SleepStepper {
+	return &SleepStepper{}
+}
+
+func (s *SleepStepper) Type() string {
+	return SleepStepperType
+}
+
+func (s *SleepStepper) RequiredInput() []Input {
+	return []Input{{Name: sleepDurationKey, Type: InputTypeDuration}}
+}
+
+func (s *SleepStepper) Step(d InputData) (Result, error) {
+	// the step is only executed again once it has woken up.
+	stepUUID := d.UnmarshalString("step_uuid")
+	if until := d.UnmarshalString(sleptUntilKey); until != "" && d.UnmarshalString(sleepingStepKey) == stepUUID {
+		return Result{State: StateSuccess, Data: InputData{sleptUntilKey: until}}, nil
+	}
+
+	until := time.Now().UTC().Add(toDuration(d[sleepDurationKey]))
+	return Sleep(until, InputData{
+		sleepingStepKey: stepUUID,
+		sleptUntilKey:   until.Format(time.RFC3339),
+	}), nil
+}
+
+func toDuration(val interface{}) time.Duration {
+	switch v := val.(type) {
+	case time.Duration:
+		return v
+	case Duration:
+		return time.Duration(v)
+	case string:
+		d, _ := time.ParseDuration(v)
+		return d
+	}
+	return 0
+}
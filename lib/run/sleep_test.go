@@ -0,0 +1,31 @@
+package run_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mitchfriedman/workflow/lib/run"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSleepStepper(t *testing.T) {
+	s := run.NewSleepStepper()
+
+	res, err := s.Step(run.InputData{"step_uuid": "ST-1", "duration": "10m"})
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateQueued, res.State)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), *res.WakeAt, time.Minute)
+
+	// once woken up, the output of the sleep is part of the input of the step.
+	woken := run.InputData{"step_uuid": "ST-1", "duration": "10m"}.Merge(res.Data)
+	res, err = s.Step(woken)
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateSuccess, res.State)
+	assert.Nil(t, res.WakeAt)
+
+	// the output of an earlier sleep step doesn't wake up another one.
+	res, err = s.Step(woken.Merge(run.InputData{"step_uuid": "ST-2"}))
+	assert.Nil(t, err)
+	assert.Equal(t, run.StateQueued, res.State)
+}
@@ -2,8 +2,7 @@ package run
 
 import (
 	"fmt"
-
-	"github.com/pkg/errors"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -25,26 +24,100 @@ type Step struct {
 	Output    Result    `json:"output"`
 	State     State     `json:"state"`
 	StepType  string    `json:"step_type"`
+
+	// Branches are executed concurrently once this step succeeds. OnSuccess
+	// then acts as the join: it is executed once Quorum branches have
+	// succeeded (all of them when Quorum is zero). If the quorum can no
+	// longer be reached, OnFailure is executed instead.
+	Branches []*Step `json:"branches"`
+	Quorum   int     `json:"quorum"`
+
+	// Outcomes routes a successful step to a named successor based on the
+	// OutcomeKey of its output. OnSuccess is followed when the outcome is
+	// missing or has no matching route.
+	Outcomes map[string]*Step `json:"outcomes"`
+
+	// Retry is the policy applied when the Stepper returns an error. Attempts
+	// counts the attempts that have returned an error so far and LastError
+	// holds the most recent one. The step isn't executed before NotBefore.
+	Retry     *RetryPolicy `json:"retry"`
+	Attempts  int          `json:"attempts"`
+	LastError string       `json:"last_error"`
+	NotBefore *time.Time   `json:"not_before"`
+
+	// Timeout bounds each execution of the step, which started at Started.
+	// A step that runs past it fails so that OnFailure is executed. Zero
+	// leaves the step without a timeout of its own.
+	Timeout Duration   `json:"timeout"`
+	Started *time.Time `json:"started"`
+
+	// Signal is the name of the signal the step is waiting for. The step
+	// isn't executed again until the signal is delivered, unless NotBefore is
+	// set and passes first.
+	Signal string `json:"signal"`
+
+	// Compensate is the step type that undoes the step once it has completed,
+	// if a later step of the run fails without an OnFailure step of its own.
+	// Compensates is set on the compensating step to the uuid of the step it
+	// undoes.
+	Compensate  string `json:"compensate"`
+	Compensates string `json:"compensates"`
+
+	// ChildRun is the uuid of the run the step launched, if any. See
+	// JobStepper.
+	ChildRun string `json:"child_run,omitempty"`
 }
 
-const failureMessage = "failure_message"
+// OutcomeKey is the key in a Result's Data that is used to pick one of the
+// Outcomes of a step.
+const OutcomeKey = "outcome"
 
-var ErrMissingRequiredInput = errors.New("required input is missing")
+const failureMessage = "failure_message"
 
+// InputSatisfied checks that data holds every required input with the
+// correct type. See ValidateInput.
 func InputSatisfied(data InputData, requiredInput []Input) error {
-	for _, ri := range requiredInput {
-		_, ok := data[ri.Name]
-		if !ok {
-			return errors.Wrapf(ErrMissingRequiredInput, "missing field %+v", ri)
+	_, err := ValidateInput(data, requiredInput)
+	return err
+}
+
+func (s *Step) Terminal() bool {
+	return s.OnSuccess == nil && s.OnFailure == nil && len(s.Branches) == 0 && len(s.Outcomes) == 0
+}
+
+// Successor returns the step to execute once s has succeeded.
+func (s *Step) Successor() *Step {
+	if _, ok := s.Output.Data[OutcomeKey]; ok {
+		if next, ok := s.Outcomes[s.Output.Data.UnmarshalString(OutcomeKey)]; ok {
+			return next
 		}
-		// TODO: validate the type of the input.
 	}
+	return s.OnSuccess
+}
 
-	return nil
+// Apply copies the outcome of an execution of from onto s, leaving the edges
+// of s as they are.
+func (s *Step) Apply(from *Step) {
+	s.Input = from.Input
+	s.Output = from.Output
+	s.State = from.State
+	s.Attempts = from.Attempts
+	s.LastError = from.LastError
+	s.NotBefore = from.NotBefore
+	s.Started = from.Started
+	s.Signal = from.Signal
+	s.ChildRun = from.ChildRun
 }
 
-func (s *Step) Terminal() bool {
-	return s.OnSuccess == nil && s.OnFailure == nil
+// TimedOut reports whether the current execution of the step has run past its
+// Timeout at now.
+func (s *Step) TimedOut(now time.Time) bool {
+	return s.State == StateQueued && s.Timeout > 0 && s.Started != nil && now.Sub(*s.Started) > time.Duration(s.Timeout)
+}
+
+// TimeoutMessage is the failure message of a step that ran past timeout.
+func TimeoutMessage(timeout time.Duration) string {
+	return fmt.Sprintf("step timed out after %s", timeout)
 }
 
 func (s *Step) Fail(m string) {
@@ -58,10 +131,72 @@ func (s *Step) Fail(m string) {
 	}
 }
 
+// Parked reports whether the step is waiting to be woken up, by a signal or
+// the time its Stepper asked for, rather than waiting to be retried.
+func (s *Step) Parked() bool {
+	return s.State == StateQueued && (s.Output.WakeAt != nil || s.Output.Signal != "")
+}
+
+// Eligible reports whether the step can be executed at the given time.
+func (s *Step) Eligible(now time.Time) bool {
+	if s.NotBefore == nil {
+		return s.Signal == ""
+	}
+	return !now.Before(*s.NotBefore)
+}
+
+// RecordError records a failed attempt to execute the step. The next attempt
+// is delayed by the backoff of its RetryPolicy, or of DefaultRetryPolicy when
+// it has none, and the step errors once the error isn't retryable or its
+// attempts are exhausted.
+func (s *Step) RecordError(err error, now time.Time) {
+	s.Attempts++
+	s.LastError = err.Error()
+
+	policy := s.Retry
+	if policy == nil {
+		policy = &DefaultRetryPolicy
+	}
+
+	if !policy.Retryable(err) || policy.Exhausted(s.Attempts) {
+		s.Abort(fmt.Sprintf("step errored after %d attempt(s): %v", s.Attempts, err))
+		return
+	}
+
+	next := now.Add(policy.Backoff(s.Attempts))
+	s.NotBefore = &next
+}
+
+// Abort moves the step into the error state, which the run can't recover
+// from, recording m as the failure message in its output.
+func (s *Step) Abort(m string) {
+	s.State = StateError
+	s.NotBefore = nil
+	s.Output = Result{
+		Data: s.Output.Data.Merge(InputData{
+			failureMessage: m,
+		}),
+		State: StateError,
+		Error: m,
+	}
+}
+
 type Result struct {
 	State State     `json:"state"`
 	Data  InputData `json:"data"`
 	Error string    `json:"error"`
+
+	// WakeAt parks a queued step until the given time, instead of executing
+	// it again as soon as possible. See Sleep.
+	WakeAt *time.Time `json:"wake_at,omitempty"`
+
+	// Signal parks a queued step until the signal is delivered, or WakeAt
+	// passes when it's set. See AwaitSignal.
+	Signal string `json:"signal,omitempty"`
+
+	// ChildRun is the uuid of a run launched by the step. It's recorded on
+	// the step so that the run links to its children.
+	ChildRun string `json:"child_run,omitempty"`
 }
 
 func generateGraphFromStepTemplate(s *Step) *Step {
@@ -72,6 +207,15 @@ func generateGraphFromStepTemplate(s *Step) *Step {
 	step := stepFactory(s)
 	step.OnSuccess = generateGraphFromStepTemplate(s.OnSuccess)
 	step.OnFailure = generateGraphFromStepTemplate(s.OnFailure)
+	for _, b := range s.Branches {
+		step.Branches = append(step.Branches, generateGraphFromStepTemplate(b))
+	}
+	if len(s.Outcomes) > 0 {
+		step.Outcomes = make(map[string]*Step, len(s.Outcomes))
+		for outcome, o := range s.Outcomes {
+			step.Outcomes[outcome] = generateGraphFromStepTemplate(o)
+		}
+	}
 
 	return step
 }
@@ -83,10 +227,14 @@ func generateUUID(prefix string) string {
 func stepFactory(t *Step) *Step {
 	pID := generateUUID("ST")
 	return &Step{
-		Input:    t.Input,
-		State:    StateQueued,
-		StepType: t.StepType,
-		UUID:     pID,
-		Output:   Result{Data: make(map[string]interface{})},
+		Input:      t.Input,
+		State:      StateQueued,
+		StepType:   t.StepType,
+		UUID:       pID,
+		Output:     Result{Data: make(map[string]interface{})},
+		Quorum:     t.Quorum,
+		Retry:      t.Retry,
+		Timeout:    t.Timeout,
+		Compensate: t.Compensate,
 	}
 }
@@ -1,9 +1,17 @@
 package run
 
-import "errors"
+import (
+	"context"
+	"errors"
+)
 
+// Input describes an input of a Stepper. Optional inputs that are missing
+// are given their Default, if any.
 type Input struct {
-	Name, Type string
+	Name     string      `json:"name"`
+	Type     string      `json:"type"`
+	Optional bool        `json:"optional"`
+	Default  interface{} `json:"default"`
 }
 
 type Stepper interface {
@@ -12,21 +20,57 @@ type Stepper interface {
 	RequiredInput() []Input
 }
 
+// ContextStepper is a Stepper that receives a context. The context carries the
+// uuids of the run and step being executed, see RunUUIDFromContext and
+// StepUUIDFromContext, and is cancelled when the step should stop: the engine
+// is shutting down, the run was cancelled or the step ran past its deadline.
+type ContextStepper interface {
+	StepContext(context.Context, InputData) (Result, error)
+	Type() string
+	RequiredInput() []Input
+}
+
+// WithContext adapts a Stepper to a ContextStepper that ignores the context.
+func WithContext(s Stepper) ContextStepper {
+	return &contextStepper{s}
+}
+
+type contextStepper struct {
+	Stepper
+}
+
+func (c *contextStepper) StepContext(_ context.Context, d InputData) (Result, error) {
+	return c.Step(d)
+}
+
+// unwrapStepper returns the Stepper that was adapted with WithContext, if any,
+// so that the optional interfaces it implements can be found.
+func unwrapStepper(s ContextStepper) interface{} {
+	if c, ok := s.(*contextStepper); ok {
+		return c.Stepper
+	}
+	return s
+}
+
 type StepperStore struct {
-	steppers map[string]Stepper
+	steppers map[string]ContextStepper
 }
 
 func NewStepperStore() *StepperStore {
 	return &StepperStore{
-		steppers: make(map[string]Stepper),
+		steppers: make(map[string]ContextStepper),
 	}
 }
 
 func (s *StepperStore) Register(stepper Stepper) {
+	s.RegisterContext(WithContext(stepper))
+}
+
+func (s *StepperStore) RegisterContext(stepper ContextStepper) {
 	s.steppers[stepper.Type()] = stepper
 }
 
-func (s *StepperStore) Get(t string) (Stepper, error) {
+func (s *StepperStore) Get(t string) (ContextStepper, error) {
 	stepper, ok := s.steppers[t]
 	if !ok {
 		return nil, errors.New("no such stepper found")
@@ -8,14 +8,30 @@ var ErrJobNotFound = errors.New("job not found")
 
 type JobStore struct {
 	jobs []Job
+	ss   *StepperStore
 }
 
-func NewJobsStore() *JobStore {
-	return &JobStore{}
+// NewJobsStore creates a JobStore that validates the jobs registered in it
+// against the steppers in ss, so the steppers of a job must be registered
+// before the job itself.
+func NewJobsStore(ss *StepperStore) *JobStore {
+	return &JobStore{ss: ss}
 }
 
-func (s *JobStore) Register(j Job) {
+// Register validates the job and adds it to the store. Invalid jobs, jobs
+// with a step type that has no registered Stepper and jobs with the same name
+// as a registered job are refused with a ValidationError.
+func (s *JobStore) Register(j Job) error {
+	if err := j.Validate(s.ss); err != nil {
+		return err
+	}
+
+	if _, err := s.Fetch(j.Name); err == nil {
+		return &ValidationError{Problems: []Problem{{Job: j.Name, Message: "a job with this name is already registered"}}}
+	}
+
 	s.jobs = append(s.jobs, j)
+	return nil
 }
 
 func (s *JobStore) Jobs() []Job {
@@ -0,0 +1,111 @@
+package run
+
+// Transition calculates the state of a run, and whether it is rolling back,
+// after a step finishes in resultState.
+func Transition(resultState State, isRollback bool, onSuccess, onFailure *Step) (State, bool) {
+	/* The state transition logic can be described as follows:
+	1. step success?
+		-> have an OnSuccess?
+			-> execute the on success (run state -> queued)
+		-> don't have an onSuccess?
+			-> is this executing a current rollback?
+				-> yes?
+					-> run state is now failed (since it was a rollback)
+				-> no?
+					-> run state is now success (since not a rollback)
+	2. step failure?
+		-> have an OnFailure?
+			-> run state is now queued, rollback = true
+		-> don't have an OnFailure?
+			-> run state is now error (no way to handle this failure)
+	3. step errpr?
+		-> go to error state, do not attempt rollback.
+	*/
+	switch resultState {
+	case StateFailed:
+		if onFailure == nil {
+			return StateError, isRollback
+		}
+		return StateQueued, true
+	case StateSuccess:
+		if onSuccess == nil {
+			if isRollback {
+				return StateFailed, isRollback
+			}
+			return StateSuccess, isRollback
+		} else {
+			return StateQueued, isRollback
+		}
+	case StateError:
+		return StateError, isRollback
+	}
+	// state is still queued - no change to the state or rollback status.
+	return StateQueued, isRollback
+}
+
+// resolve walks the executed path of the graph starting at s, applying
+// Transition to every step along the way. It returns the resulting state,
+// whether the path is rolling back and the output accumulated along the path.
+func resolve(s *Step, isRollback bool, d InputData) (State, bool, InputData) {
+	if s == nil {
+		return StateSuccess, isRollback, d
+	}
+
+	state := s.State
+	d = d.Merge(s.Output.Data)
+	if state == StateSuccess && len(s.Branches) > 0 {
+		state, d = resolveBranches(s, d)
+	}
+
+	if state == StateQueued {
+		return StateQueued, isRollback, d
+	}
+
+	// an errored step that is being compensated rolls back like a failed one.
+	if state == StateError && compensating(s) {
+		state = StateFailed
+	}
+
+	next, rollback := Transition(state, isRollback, s.Successor(), s.OnFailure)
+	if next != StateQueued {
+		return next, rollback, d
+	}
+
+	if state == StateSuccess {
+		return resolve(s.Successor(), rollback, d)
+	}
+	return resolve(s.OnFailure, rollback, d)
+}
+
+// resolveBranches determines the outcome of the branches of a fan-out step.
+// It is StateSuccess once the quorum of branches has succeeded, StateFailed
+// once the quorum can no longer be reached and StateQueued otherwise. The
+// output of every successful branch is merged into the returned data.
+func resolveBranches(s *Step, d InputData) (State, InputData) {
+	quorum := s.Quorum
+	if quorum <= 0 || quorum > len(s.Branches) {
+		quorum = len(s.Branches)
+	}
+
+	var succeeded, pending int
+	data := d
+	for _, b := range s.Branches {
+		state, _, out := resolve(b, false, d)
+		switch state {
+		case StateSuccess:
+			succeeded++
+			data = data.Merge(out)
+		case StateQueued:
+			pending++
+		}
+	}
+
+	switch {
+	case succeeded >= quorum:
+		return StateSuccess, data
+	case succeeded+pending >= quorum:
+		return StateQueued, data
+	default:
+		return StateFailed, data
+	}
+}
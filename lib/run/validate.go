@@ -0,0 +1,247 @@
+package run
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// OutputProvider can be implemented by a Stepper to declare the output it
+// produces, so that Validate can check the required input of the steps that
+// follow it.
+type OutputProvider interface {
+	Outputs() []Input
+}
+
+// Problem is a single issue found while validating a Job. Path is the list of
+// edges taken from the start of the job to reach the step.
+type Problem struct {
+	Job     string `json:"job"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	if p.Path == "" {
+		return fmt.Sprintf("%s: %s", p.Job, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.Job, p.Path, p.Message)
+}
+
+// ValidationError is returned when a Job is invalid. It lists every problem
+// that was found.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		problems[i] = p.String()
+	}
+	return fmt.Sprintf("invalid job: %s", strings.Join(problems, "; "))
+}
+
+// Validate checks that the step graph of the job can be executed. It checks
+// that the graph is free of cycles and that every branch, outcome and join
+// can be reached. When ss is provided, it also checks that every step type
+// has a registered Stepper and, if the job declares its Input, that the
+// required input of every Stepper is available along each path to it.
+func (j Job) Validate(ss *StepperStore) error {
+	v := validator{job: j, ss: ss, visiting: make(map[*Step]bool)}
+
+	if j.Name == "" {
+		v.problem(nil, "job is missing a name")
+	}
+
+	if j.Start == nil {
+		v.problem(nil, "job has no start step")
+	} else if v.checkGraph(j.Start, []string{j.Start.StepType}) && ss != nil && j.Input != nil {
+		known := make(map[string]bool)
+		for _, in := range j.Input {
+			known[in.Name] = true
+		}
+		v.checkInput(j.Start, []string{j.Start.StepType}, known)
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+type validator struct {
+	job      Job
+	ss       *StepperStore
+	visiting map[*Step]bool
+	problems []Problem
+}
+
+func (v *validator) problem(path []string, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{
+		Job:     v.job.Name,
+		Path:    strings.Join(path, " -> "),
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// edges returns the steps that can follow s, along with the name of the edge
+// that leads to each of them.
+func edges(s *Step) ([]string, []*Step) {
+	var names []string
+	var steps []*Step
+	add := func(name string, next *Step) {
+		names = append(names, name)
+		steps = append(steps, next)
+	}
+
+	for i, b := range s.Branches {
+		add(fmt.Sprintf("branches[%d]", i), b)
+	}
+	outcomes := make([]string, 0, len(s.Outcomes))
+	for outcome := range s.Outcomes {
+		outcomes = append(outcomes, outcome)
+	}
+	sort.Strings(outcomes)
+	for _, outcome := range outcomes {
+		add(fmt.Sprintf("outcomes[%s]", outcome), s.Outcomes[outcome])
+	}
+	if s.OnSuccess != nil {
+		add("on_success", s.OnSuccess)
+	}
+	if s.OnFailure != nil {
+		add("on_failure", s.OnFailure)
+	}
+
+	return names, steps
+}
+
+// checkGraph checks the structure of the graph starting at s. It returns
+// false if a cycle was found, since the graph can't be walked any further.
+func (v *validator) checkGraph(s *Step, path []string) bool {
+	if v.visiting[s] {
+		v.problem(path, "step %q forms a cycle", s.StepType)
+		return false
+	}
+	v.visiting[s] = true
+	defer delete(v.visiting, s)
+
+	if s.StepType == "" {
+		v.problem(path, "step is missing a step type")
+	} else if v.ss != nil {
+		if _, err := v.ss.Get(s.StepType); err != nil {
+			v.problem(path, "no stepper registered for step type %q", s.StepType)
+		}
+	}
+	if s.Compensate != "" && v.ss != nil {
+		if _, err := v.ss.Get(s.Compensate); err != nil {
+			v.problem(path, "no stepper registered for compensating step type %q", s.Compensate)
+		}
+	}
+
+	if len(s.Branches) > 0 && (s.Quorum < 0 || s.Quorum > len(s.Branches)) {
+		v.problem(path, "quorum of %d can never be reached with %d branches", s.Quorum, len(s.Branches))
+	}
+	if len(s.Branches) == 0 && s.Quorum != 0 {
+		v.problem(path, "quorum is set but the step has no branches")
+	}
+
+	acyclic := true
+	names, next := edges(s)
+	for i, n := range next {
+		p := append(path[:len(path):len(path)], names[i])
+		if n == nil {
+			v.problem(p, "edge does not lead to a step")
+			continue
+		}
+		if !v.checkGraph(n, append(p, n.StepType)) {
+			acyclic = false
+		}
+	}
+
+	return acyclic
+}
+
+// checkInput checks that the required input of s, and every step after it,
+// is available from the input of the job, the static input of the steps
+// along the path and the declared output of the steps that came before.
+func (v *validator) checkInput(s *Step, path []string, known map[string]bool) {
+	known = copyKnown(known)
+	known["run_uuid"] = true
+	known["step_uuid"] = true
+	for k := range s.Input {
+		known[k] = true
+	}
+
+	stepper, err := v.ss.Get(s.StepType)
+	if err != nil {
+		// already reported by checkGraph.
+		return
+	}
+
+	for _, in := range stepper.RequiredInput() {
+		if in.Optional {
+			continue
+		}
+		if !known[in.Name] {
+			v.problem(path, "required input %q is not provided", in.Name)
+		}
+	}
+
+	after := copyKnown(known)
+	after[failureMessage] = true
+	if op, ok := unwrapStepper(stepper).(OutputProvider); ok {
+		for _, out := range op.Outputs() {
+			after[out.Name] = true
+		}
+	}
+
+	// the join can use the output of any of the branches.
+	join := copyKnown(after)
+	for _, b := range s.Branches {
+		v.collectOutputs(b, join)
+	}
+
+	names, next := edges(s)
+	for i, n := range next {
+		if n == nil {
+			continue
+		}
+		p := append(path[:len(path):len(path)], names[i], n.StepType)
+		if n == s.OnSuccess && len(s.Branches) > 0 {
+			v.checkInput(n, p, join)
+		} else {
+			v.checkInput(n, p, after)
+		}
+	}
+}
+
+func (v *validator) collectOutputs(s *Step, known map[string]bool) {
+	if s == nil {
+		return
+	}
+
+	for k := range s.Input {
+		known[k] = true
+	}
+	if stepper, err := v.ss.Get(s.StepType); err == nil {
+		if op, ok := unwrapStepper(stepper).(OutputProvider); ok {
+			for _, out := range op.Outputs() {
+				known[out.Name] = true
+			}
+		}
+	}
+
+	_, next := edges(s)
+	for _, n := range next {
+		v.collectOutputs(n, known)
+	}
+}
+
+func copyKnown(known map[string]bool) map[string]bool {
+	c := make(map[string]bool, len(known))
+	for k, v := range known {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,107 @@
+package run_test
+
+import (
+	"testing"
+
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type inputStep struct {
+	run.Stepper
+	t        string
+	required []run.Input
+	outputs  []run.Input
+}
+
+func (s *inputStep) Type() string               { return s.t }
+func (s *inputStep) RequiredInput() []run.Input { return s.required }
+func (s *inputStep) Outputs() []run.Input       { return s.outputs }
+
+func TestJob_Validate(t *testing.T) {
+	ss := testhelpers.CreateStepperStore()
+	ss.Register(&inputStep{t: "build", outputs: []run.Input{{Name: "image", Type: run.InputTypeString}}})
+	ss.Register(&inputStep{t: "deploy", required: []run.Input{{Name: "image", Type: run.InputTypeString}, {Name: "region", Type: run.InputTypeString}}})
+	ss.Register(&inputStep{t: "notify", required: []run.Input{{Name: "channel", Type: run.InputTypeString, Optional: true, Default: "#deploys"}}})
+	ss.Register(run.NewApprovalStepper())
+
+	cycle := testhelpers.CreateStep("say_hello")
+	cycle.OnSuccess = testhelpers.CreateStep("ask_question")
+	cycle.OnSuccess.OnFailure = cycle
+
+	unknown := testhelpers.CreateStep("say_hello")
+	unknown.OnSuccess = testhelpers.CreateStep("nope")
+
+	badQuorum := testhelpers.CreateStep("say_hello")
+	badQuorum.Branches = []*run.Step{testhelpers.CreateStep("say_goodbye1")}
+	badQuorum.Quorum = 2
+
+	nilOutcome := testhelpers.CreateStep("say_hello")
+	nilOutcome.Outcomes = map[string]*run.Step{"hold": nil}
+
+	unknownCompensation := testhelpers.CreateStep("say_hello")
+	unknownCompensation.Compensate = "nope"
+
+	deployWithInput := func() *run.Step {
+		build := testhelpers.CreateStep("build")
+		build.OnSuccess = testhelpers.CreateStep("deploy")
+		build.OnSuccess.Input = run.InputData{"region": "us-east-1"}
+		return build
+	}
+
+	deployWithoutBuild := testhelpers.CreateStep("deploy")
+
+	withJobInput := func(j run.Job, in ...run.Input) run.Job {
+		j.Input = append([]run.Input{}, in...)
+		return j
+	}
+
+	tests := map[string]struct {
+		job          run.Job
+		ss           *run.StepperStore
+		wantProblems int
+	}{
+		"valid job":                        {testhelpers.CreateSampleJob("job"), ss, 0},
+		"missing name":                     {run.NewJob("", testhelpers.CreateStep("say_hello")), ss, 1},
+		"missing start":                    {run.NewJob("job", nil), ss, 1},
+		"with a cycle":                     {run.NewJob("job", cycle), ss, 1},
+		"with an unknown stepper":          {run.NewJob("job", unknown), ss, 1},
+		"unknown stepper without a store":  {run.NewJob("job", unknown), nil, 0},
+		"with an unknown compensation":     {run.NewJob("job", unknownCompensation), ss, 1},
+		"with an unreachable quorum":       {run.NewJob("job", badQuorum), ss, 1},
+		"with an outcome leading nowhere":  {run.NewJob("job", nilOutcome), ss, 1},
+		"with input provided along a path": {withJobInput(run.NewJob("job", deployWithInput())), ss, 0},
+		"with missing input":               {withJobInput(run.NewJob("job", deployWithoutBuild)), ss, 2},
+		"with missing input from job":      {withJobInput(run.NewJob("job", deployWithoutBuild), run.Input{Name: "image"}), ss, 1},
+		"without declared job input":       {run.NewJob("job", deployWithoutBuild), ss, 0},
+		"without optional input":           {withJobInput(run.NewJob("job", testhelpers.CreateStep("notify"))), ss, 0},
+		"approval without approvers":       {withJobInput(run.NewJob("job", testhelpers.CreateStep(run.ApprovalStepperType))), ss, 0},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			err := tc.job.Validate(tc.ss)
+			if tc.wantProblems == 0 {
+				assert.Nil(t, err)
+				return
+			}
+
+			verr, ok := err.(*run.ValidationError)
+			if assert.True(t, ok) {
+				assert.Len(t, verr.Problems, tc.wantProblems)
+			}
+		})
+	}
+}
+
+func TestJobStore_Register(t *testing.T) {
+	js := run.NewJobsStore(testhelpers.CreateStepperStore())
+
+	assert.Nil(t, js.Register(testhelpers.CreateSampleJob("job")))
+	assert.NotNil(t, js.Register(testhelpers.CreateSampleJob("job")))
+	assert.NotNil(t, js.Register(run.NewJob("other", testhelpers.CreateStep("nope"))))
+	assert.Len(t, js.Jobs(), 1)
+}
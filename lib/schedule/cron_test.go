@@ -0,0 +1,67 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mitchfriedman/workflow/lib/schedule"
+)
+
+func TestParseCron_Invalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@never",
+	}
+
+	for _, expr := range tests {
+		expr := expr
+		t.Run(expr, func(t *testing.T) {
+			_, err := schedule.ParseCron(expr)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestCron_Next(t *testing.T) {
+	// a wednesday.
+	from := time.Date(2019, 10, 16, 10, 17, 30, 0, time.UTC)
+
+	tests := map[string]struct {
+		expr string
+		want time.Time
+	}{
+		"every minute":         {"* * * * *", time.Date(2019, 10, 16, 10, 18, 0, 0, time.UTC)},
+		"every 15 minutes":     {"*/15 * * * *", time.Date(2019, 10, 16, 10, 30, 0, 0, time.UTC)},
+		"list of minutes":      {"5,20,40 * * * *", time.Date(2019, 10, 16, 10, 20, 0, 0, time.UTC)},
+		"range of hours":       {"0 2-4 * * *", time.Date(2019, 10, 17, 2, 0, 0, 0, time.UTC)},
+		"stepped range":        {"0 9-17/4 * * *", time.Date(2019, 10, 16, 13, 0, 0, 0, time.UTC)},
+		"day of month":         {"30 6 1 * *", time.Date(2019, 11, 1, 6, 30, 0, 0, time.UTC)},
+		"day of week":          {"0 0 * * 1-5", time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC)},
+		"sunday as 7":          {"0 0 * * 7", time.Date(2019, 10, 20, 0, 0, 0, 0, time.UTC)},
+		"day of month or week": {"0 0 31 * 5", time.Date(2019, 10, 18, 0, 0, 0, 0, time.UTC)},
+		"end of the year":      {"0 0 31 12 *", time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC)},
+		"descriptor":           {"@daily", time.Date(2019, 10, 17, 0, 0, 0, 0, time.UTC)},
+		"leap day":             {"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		"never":                {"0 0 30 2 *", time.Time{}},
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			c, err := schedule.ParseCron(tc.expr)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, c.Next(from))
+		})
+	}
+}
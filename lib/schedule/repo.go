@@ -0,0 +1,139 @@
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	database "github.com/mitchfriedman/workflow/lib/db"
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/tracing"
+)
+
+var ErrNotFound = errors.New("record not found")
+
+type Repo interface {
+	CreateSchedule(context.Context, *Schedule) error
+	DeleteSchedule(context.Context, string) error
+	ListSchedules(context.Context) ([]*Schedule, error)
+	Fire(context.Context, *Schedule, time.Time, *run.Run) (bool, error)
+	AcquireLease(context.Context, string, string, time.Duration) (bool, error)
+}
+
+type Storage struct {
+	db *database.DB
+}
+
+func NewDatabaseStorage(db *database.DB) *Storage {
+	return &Storage{db: db}
+}
+
+func (r *Storage) CreateSchedule(ctx context.Context, s *Schedule) error {
+	if err := s.MarshalScheduleData(); err != nil {
+		return err
+	}
+	s.Created = time.Now().UTC()
+
+	span, db, ctx := tracing.NewDBSpan(ctx, r.db.Master, "schedule.create_schedule")
+	err := db.Create(s).Error
+	span.RecordError(err)
+	span.Finish()
+
+	return err
+}
+
+func (r *Storage) DeleteSchedule(ctx context.Context, uuid string) error {
+	span, db, ctx := tracing.NewDBSpan(ctx, r.db.Master, "schedule.delete_schedule")
+	res := db.Where("uuid = ?", uuid).Delete(&Schedule{})
+	span.RecordError(res.Error)
+	span.Finish()
+
+	switch {
+	case res.Error != nil:
+		return res.Error
+	case res.RowsAffected == 0:
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *Storage) ListSchedules(ctx context.Context) ([]*Schedule, error) {
+	var schedules []*Schedule
+	span, db, ctx := tracing.NewDBSpan(ctx, r.db.Reader, "schedule.list_schedules")
+	err := db.Find(&schedules).Error
+	span.RecordError(err)
+	span.Finish()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query schedules")
+	}
+
+	for _, s := range schedules {
+		if err := s.UnmarshalScheduleData(); err != nil {
+			return nil, err
+		}
+	}
+	return schedules, nil
+}
+
+// Fire records that s fired at the time at and creates r, the run of that
+// time, in the same transaction. It only succeeds if no one else has marked s
+// as fired since it was read, so that every time of the schedule fires once,
+// and a time isn't marked as fired unless its run was created.
+func (r *Storage) Fire(ctx context.Context, s *Schedule, at time.Time, fired *run.Run) (bool, error) {
+	tx := r.db.Master.BeginTx(ctx, nil)
+	if tx.Error != nil {
+		return false, errors.Wrap(tx.Error, "failed to begin transaction")
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	span, db, ctx := tracing.NewDBSpan(ctx, tx, "schedule.mark_fired")
+	db = db.Table("schedules").Where("uuid = ?", s.UUID)
+	if s.LastFired == nil {
+		db = db.Where("last_fired IS NULL")
+	} else {
+		db = db.Where("last_fired = ?", *s.LastFired)
+	}
+	res := db.Updates(map[string]interface{}{"last_fired": at})
+	span.RecordError(res.Error)
+	span.Finish()
+
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return false, nil
+	}
+
+	if err := run.InsertRun(ctx, tx, fired); err != nil {
+		return false, errors.Wrap(err, "failed to create run")
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, errors.Wrap(err, "failed to commit fired schedule")
+	}
+
+	s.LastFired = &at
+	return true, nil
+}
+
+// AcquireLease takes or renews the lease called name for holder, unless
+// another holder has it and it hasn't expired. It returns whether holder has
+// the lease.
+func (r *Storage) AcquireLease(ctx context.Context, name, holder string, d time.Duration) (bool, error) {
+	now := time.Now().UTC()
+
+	span, db, ctx := tracing.NewDBSpan(ctx, r.db.Master, "schedule.acquire_lease")
+	res := db.Exec(`
+		INSERT INTO leases (name, holder, expires) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires = excluded.expires
+		WHERE leases.holder = excluded.holder OR leases.expires < ?`,
+		name, holder, now.Add(d), now)
+	span.RecordError(res.Error)
+	span.Finish()
+
+	if res.Error != nil {
+		return false, errors.Wrapf(res.Error, "failed to acquire lease %s", name)
+	}
+	return res.RowsAffected > 0, nil
+}
@@ -0,0 +1,94 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mitchfriedman/workflow/lib/run"
+)
+
+// Schedule creates runs of a Job in a scope, with static input, at the times
+// of its cron expression.
+type Schedule struct {
+	Input run.InputData   `sql:"-"`
+	Data  json.RawMessage `gorm:"type:jsonb;"`
+
+	UUID    string
+	JobName string
+	Scope   string
+	Cron    string
+
+	Created   time.Time
+	LastFired *time.Time // the time the schedule last created a run for, if any
+}
+
+// NewSchedule creates a Schedule, checking that its cron expression is valid.
+func NewSchedule(jobName, scope, cron string, input run.InputData) (*Schedule, error) {
+	if _, err := ParseCron(cron); err != nil {
+		return nil, err
+	}
+
+	return &Schedule{
+		Input:   input,
+		UUID:    fmt.Sprintf("SC-%s", uuid.New().String()),
+		JobName: jobName,
+		Scope:   scope,
+		Cron:    cron,
+	}, nil
+}
+
+func (s *Schedule) MarshalScheduleData() error {
+	var err error
+	s.Data, err = json.Marshal(s.Input)
+	return err
+}
+
+func (s *Schedule) UnmarshalScheduleData() error {
+	if len(s.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(s.Data, &s.Input); err != nil {
+		return errors.Wrap(err, "failed to unmarshal schedule data")
+	}
+	return nil
+}
+
+// Due returns the latest time at or before now that the schedule should have
+// fired at but hasn't, and whether there is one. Times missed while no
+// scheduler was running are only fired once.
+func (s *Schedule) Due(now time.Time) (time.Time, bool, error) {
+	c, err := ParseCron(s.Cron)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	from := s.Created
+	if s.LastFired != nil {
+		from = *s.LastFired
+	}
+
+	var due time.Time
+	for next := c.Next(from); !next.IsZero() && !next.After(now); next = c.Next(next) {
+		due = next
+	}
+	return due, !due.IsZero(), nil
+}
+
+// Trigger is the trigger of the run created for the time at.
+func (s *Schedule) Trigger(at time.Time) run.Trigger {
+	input := make(run.InputData, len(s.Input)+1)
+	for k, v := range s.Input {
+		input[k] = v
+	}
+	input["scheduled_at"] = at.Format(time.RFC3339)
+
+	return run.Trigger{
+		JobName: s.JobName,
+		Scope:   s.Scope,
+		Input:   input,
+	}
+}
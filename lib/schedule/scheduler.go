@@ -0,0 +1,149 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mitchfriedman/workflow/lib/logging"
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/tracing"
+)
+
+// leaseName is the lease that a Scheduler must hold to fire schedules, so
+// that only one of many replicas fires them.
+const leaseName = "scheduler"
+
+var defaultTickInterval = 15 * time.Second
+var defaultLeaseDuration = time.Minute
+
+// Scheduler creates the runs of the registered schedules when they are due.
+type Scheduler struct {
+	repo   Repo
+	jobs   *run.JobStore
+	logger logging.StructuredLogger
+	holder string
+
+	tickInterval  time.Duration
+	leaseDuration time.Duration
+}
+
+type Option func(s *Scheduler)
+
+// WithTickInterval sets how often the schedules are checked.
+func WithTickInterval(d time.Duration) Option {
+	return func(s *Scheduler) {
+		s.tickInterval = d
+	}
+}
+
+// WithLeaseDuration sets how long the scheduler holds the lease after each
+// tick. Another replica takes over once it expires.
+func WithLeaseDuration(d time.Duration) Option {
+	return func(s *Scheduler) {
+		s.leaseDuration = d
+	}
+}
+
+func NewScheduler(repo Repo, jobs *run.JobStore, logger logging.StructuredLogger, options ...Option) *Scheduler {
+	s := &Scheduler{
+		repo:          repo,
+		jobs:          jobs,
+		logger:        logger,
+		holder:        fmt.Sprintf("SH-%s", uuid.New().String()),
+		tickInterval:  defaultTickInterval,
+		leaseDuration: defaultLeaseDuration,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+	return s
+}
+
+// Add registers a schedule that creates runs of the job in scope with input
+// at the times of the cron expression.
+func (s *Scheduler) Add(ctx context.Context, jobName, scope, cron string, input run.InputData) (*Schedule, error) {
+	if _, err := s.jobs.Fetch(jobName); err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch job %s", jobName)
+	}
+
+	sc, err := NewSchedule(jobName, scope, cron, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CreateSchedule(ctx, sc); err != nil {
+		return nil, errors.Wrap(err, "failed to create schedule")
+	}
+	return sc, nil
+}
+
+// Start fires the schedules that are due every tick until ctx is done.
+func (s *Scheduler) Start(ctx context.Context) {
+	for {
+		if err := s.Tick(ctx, time.Now().UTC()); err != nil {
+			s.logger.Errorf("scheduler: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.tickInterval):
+		}
+	}
+}
+
+// Tick fires the schedules that are due at now, if the scheduler holds the
+// lease. A schedule that fails to fire is logged and doesn't stop the others.
+func (s *Scheduler) Tick(ctx context.Context, now time.Time) (err error) {
+	span, ctx := tracing.NewServiceSpan(ctx, "scheduler.tick")
+	defer func() {
+		span.RecordError(err)
+		span.Finish()
+	}()
+
+	leader, err := s.repo.AcquireLease(ctx, leaseName, s.holder, s.leaseDuration)
+	if err != nil {
+		return err
+	}
+	if !leader {
+		return nil
+	}
+
+	schedules, err := s.repo.ListSchedules(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list schedules")
+	}
+
+	for _, sc := range schedules {
+		if err := s.fire(ctx, sc, now); err != nil {
+			s.logger.Errorf("scheduler: failed to fire schedule %s: %v", sc.UUID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) fire(ctx context.Context, sc *Schedule, now time.Time) error {
+	due, ok, err := sc.Due(now)
+	if err != nil || !ok {
+		return err
+	}
+
+	j, err := s.jobs.Fetch(sc.JobName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch job %s", sc.JobName)
+	}
+
+	// the run is created along with marking the schedule as fired, so that a
+	// time is never fired twice even if the lease changes hands in the
+	// meantime, nor lost if the run can't be created.
+	r := run.NewRun(j, sc.Trigger(due))
+	if _, err := s.repo.Fire(ctx, sc, due, r); err != nil {
+		return errors.Wrapf(err, "failed to fire %s", due)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package schedule_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mitchfriedman/workflow/lib/logging"
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/schedule"
+	"github.com/mitchfriedman/workflow/lib/testhelpers"
+)
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	rr := testhelpers.NewMemoryRepo()
+	repo := testhelpers.NewMemoryScheduleRepo(rr)
+	js := run.NewJobsStore(testhelpers.CreateStepperStore())
+	assert.Nil(t, js.Register(testhelpers.CreateSampleJob("cleanup")))
+	logger := logging.New("test", os.Stderr)
+
+	// two replicas share the same schedules.
+	s1 := schedule.NewScheduler(repo, js, logger)
+	s2 := schedule.NewScheduler(repo, js, logger)
+
+	_, err := s1.Add(ctx, "missing", "app", "@hourly", nil)
+	assert.NotNil(t, err)
+	_, err = s1.Add(ctx, "cleanup", "app", "not a cron", nil)
+	assert.NotNil(t, err)
+
+	sc, err := s1.Add(ctx, "cleanup", "app", "@hourly", run.InputData{"older_than": "24h"})
+	assert.Nil(t, err)
+
+	runs := func() []*run.Run {
+		t.Helper()
+		rs, err := rr.ListByJobScope(ctx, "cleanup", "app")
+		assert.Nil(t, err)
+		return rs
+	}
+
+	// nothing is due yet.
+	assert.Nil(t, s1.Tick(ctx, time.Now().UTC()))
+	assert.Len(t, runs(), 0)
+
+	// the times missed over the last hours fire once, from one replica.
+	now := time.Now().UTC().Add(3 * time.Hour)
+	assert.Nil(t, s1.Tick(ctx, now))
+	assert.Nil(t, s2.Tick(ctx, now))
+	assert.Nil(t, s1.Tick(ctx, now))
+
+	rs := runs()
+	assert.Len(t, rs, 1)
+	due := now.Truncate(time.Hour)
+	assert.Equal(t, "24h", rs[0].Input["older_than"])
+	assert.Equal(t, due.Format(time.RFC3339), rs[0].Input["scheduled_at"])
+
+	all, err := repo.ListSchedules(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, sc.UUID, all[0].UUID)
+	assert.Equal(t, due, *all[0].LastFired)
+
+	// the next time fires once more.
+	assert.Nil(t, s1.Tick(ctx, now.Add(time.Hour)))
+	assert.Len(t, runs(), 2)
+}
+
+// failingCreator fails to create runs until it's fixed.
+type failingCreator struct {
+	*testhelpers.MemoryRepo
+	fixed bool
+}
+
+func (c *failingCreator) CreateRun(ctx context.Context, r *run.Run) error {
+	if !c.fixed {
+		return errors.New("database is down")
+	}
+	return c.MemoryRepo.CreateRun(ctx, r)
+}
+
+func TestScheduler_RunNotCreated(t *testing.T) {
+	ctx := context.Background()
+	rr := &failingCreator{MemoryRepo: testhelpers.NewMemoryRepo()}
+	repo := testhelpers.NewMemoryScheduleRepo(rr)
+	js := run.NewJobsStore(testhelpers.CreateStepperStore())
+	assert.Nil(t, js.Register(testhelpers.CreateSampleJob("cleanup")))
+	s := schedule.NewScheduler(repo, js, logging.New("test", os.Stderr))
+
+	_, err := s.Add(ctx, "cleanup", "app", "@hourly", nil)
+	assert.Nil(t, err)
+
+	// the time isn't marked as fired, so it fires on the next tick.
+	now := time.Now().UTC().Add(time.Hour)
+	assert.Nil(t, s.Tick(ctx, now))
+	all, err := repo.ListSchedules(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, all[0].LastFired)
+
+	rr.fixed = true
+	assert.Nil(t, s.Tick(ctx, now))
+	runs, err := rr.ListByJob(ctx, "cleanup")
+	assert.Nil(t, err)
+	assert.Len(t, runs, 1)
+}
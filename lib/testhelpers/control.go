@@ -0,0 +1,60 @@
+package testhelpers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mitchfriedman/workflow/lib/control"
+)
+
+// MemoryControlRepo is an in-memory control.Repo for tests that don't need a
+// database.
+type MemoryControlRepo struct {
+	mu       sync.Mutex
+	controls []control.Control
+}
+
+func NewMemoryControlRepo() *MemoryControlRepo {
+	return &MemoryControlRepo{}
+}
+
+func (m *MemoryControlRepo) Pause(ctx context.Context, c *control.Control) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c.Created = time.Now().UTC()
+	for i, existing := range m.controls {
+		if existing.JobName == c.JobName && existing.Scope == c.Scope {
+			c.Created = existing.Created
+			m.controls[i] = *c
+			return nil
+		}
+	}
+	m.controls = append(m.controls, *c)
+	return nil
+}
+
+func (m *MemoryControlRepo) Resume(ctx context.Context, job, scope string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, c := range m.controls {
+		if c.JobName == job && c.Scope == scope {
+			m.controls = append(m.controls[:i], m.controls[i+1:]...)
+			return nil
+		}
+	}
+	return control.ErrNotFound
+}
+
+func (m *MemoryControlRepo) ListControls(ctx context.Context) ([]control.Control, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]control.Control(nil), m.controls...), nil
+}
@@ -0,0 +1,156 @@
+package testhelpers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mitchfriedman/workflow/lib/run"
+)
+
+// MemoryRepo is an in-memory run.Repo for tests that don't need a database.
+type MemoryRepo struct {
+	mu   sync.Mutex
+	runs []*run.Run
+
+	// claimMu serializes ClaimNextRun, like the locks taken by run.Storage.
+	claimMu sync.Mutex
+}
+
+func NewMemoryRepo() *MemoryRepo {
+	return &MemoryRepo{}
+}
+
+func (m *MemoryRepo) CreateRun(ctx context.Context, r *run.Run) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := r.MarshalRunData(); err != nil {
+		return err
+	}
+	r.Started = time.Now().UTC()
+	m.runs = append(m.runs, r)
+	return nil
+}
+
+func (m *MemoryRepo) NextRuns(ctx context.Context) ([]*run.Run, error) {
+	now := time.Now().UTC()
+	return m.filter(func(r *run.Run) bool { return r.State == run.StateQueued && !r.Dormant(now) }), nil
+}
+
+func (m *MemoryRepo) ClaimedRuns(ctx context.Context) ([]*run.Run, error) {
+	return m.filter(func(r *run.Run) bool { return r.State == run.StateQueued }), nil
+}
+
+func (m *MemoryRepo) ListByJob(ctx context.Context, job string) ([]*run.Run, error) {
+	return m.filter(func(r *run.Run) bool { return r.JobName == job }), nil
+}
+
+func (m *MemoryRepo) ListByJobScope(ctx context.Context, job, scope string) ([]*run.Run, error) {
+	return m.filter(func(r *run.Run) bool { return r.JobName == job && r.Scope == scope }), nil
+}
+
+func (m *MemoryRepo) GetRun(ctx context.Context, uuid string) (*run.Run, error) {
+	found := m.filter(func(r *run.Run) bool { return r.UUID == uuid })
+	if len(found) == 0 {
+		return nil, run.ErrNotFound
+	}
+	return found[0], nil
+}
+
+// GetLatestRun is the same as GetRun, since a MemoryRepo has no replicas.
+func (m *MemoryRepo) GetLatestRun(ctx context.Context, uuid string) (*run.Run, error) {
+	return m.GetRun(ctx, uuid)
+}
+
+func (m *MemoryRepo) SearchForRun(ctx context.Context, job, scope, state string) (*run.Run, error) {
+	found := m.filter(func(r *run.Run) bool {
+		return r.JobName == job && r.Scope == scope && string(r.State) == state
+	})
+	if len(found) == 0 {
+		return nil, run.ErrNotFound
+	}
+	return found[0], nil
+}
+
+func (m *MemoryRepo) ClaimNextRun(ctx context.Context, workerID string, d time.Duration, prioritize run.Prioritizer) (*run.Run, error) {
+	m.claimMu.Lock()
+	defer m.claimMu.Unlock()
+
+	next := prioritize(m.filter(func(r *run.Run) bool { return r.State == run.StateQueued }))
+	if next == nil {
+		return nil, nil
+	}
+
+	if err := m.ClaimRun(ctx, next, workerID, d); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+func (m *MemoryRepo) ClaimRun(ctx context.Context, r *run.Run, workerID string, d time.Duration) error {
+	n := time.Now().UTC().Add(d)
+	r.ClaimedBy = &workerID
+	r.ClaimedUntil = &n
+	return m.save(r)
+}
+
+func (m *MemoryRepo) ReleaseRun(ctx context.Context, r *run.Run) error {
+	r.ClaimedBy = nil
+	r.ClaimedUntil = nil
+	if r.Terminal() {
+		n := time.Now()
+		r.Finished = &n
+	}
+	return m.save(r)
+}
+
+func (m *MemoryRepo) SaveRun(ctx context.Context, r *run.Run) error {
+	if r.Terminal() {
+		n := time.Now()
+		r.Finished = &n
+	}
+	return m.save(r)
+}
+
+func (m *MemoryRepo) save(r *run.Run) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := r.MarshalRunData(); err != nil {
+		return err
+	}
+
+	for i, existing := range m.runs {
+		if existing.UUID == r.UUID {
+			if existing.Version != r.Version {
+				return run.ErrConflict
+			}
+			r.Version++
+			c := *r
+			m.runs[i] = &c
+			return nil
+		}
+	}
+	return run.ErrNotFound
+}
+
+// filter returns copies of the stored runs that match f, with their run data
+// unmarshalled, so callers can't modify the stored runs without saving them.
+func (m *MemoryRepo) filter(f func(*run.Run) bool) []*run.Run {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var found []*run.Run
+	for _, r := range m.runs {
+		if !f(r) {
+			continue
+		}
+		c := *r
+		if err := c.UnmarshalRunData(); err != nil {
+			panic(err)
+		}
+		found = append(found, &c)
+	}
+	return found
+}
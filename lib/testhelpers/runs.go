@@ -32,6 +32,17 @@ func CreateSampleRunFirstStepFailure(jobName, scope string, input run.InputData)
 }
 
 func CreateSampleRun(jobName, scope string, input run.InputData) *run.Run {
+	j := CreateSampleJob(jobName)
+	trig := run.Trigger{
+		JobName: jobName,
+		Scope:   scope,
+		Input:   input,
+	}
+
+	return run.NewRun(j, trig)
+}
+
+func CreateSampleJob(jobName string) run.Job {
 	/*
 
 			CreateRun a graph that has a few paths. It looks like:
@@ -56,6 +67,18 @@ func CreateSampleRun(jobName, scope string, input run.InputData) *run.Run {
 	hello.OnFailure = goodbye
 	hello.OnFailure.OnSuccess = goodbye2
 
+	return run.NewJob(jobName, hello)
+}
+
+// CreateSampleFanOutRun creates a run that says hello, then says goodbye on
+// two branches concurrently before joining them to ask a question once quorum
+// branches have succeeded.
+func CreateSampleFanOutRun(jobName, scope string, quorum int, input run.InputData) *run.Run {
+	hello := CreateStep("say_hello")
+	hello.Branches = []*run.Step{CreateStep("say_goodbye1"), CreateStep("say_goodbye2")}
+	hello.Quorum = quorum
+	hello.OnSuccess = CreateStep("ask_question")
+
 	j := run.NewJob(jobName, hello)
 	trig := run.Trigger{
 		JobName: jobName,
@@ -80,3 +103,24 @@ func CreateSampleResultWithOutput(state run.State, ks ...string) run.Result {
 func generateUUID(prefix string) string {
 	return fmt.Sprintf("%s-%s", prefix, string(uuid.New().String()))
 }
+
+// CreateSampleOutcomeRun creates a run that asks a question and then routes
+// to say_goodbye1 on a "yes" outcome, say_goodbye2 on a "no" outcome and
+// say_hello otherwise.
+func CreateSampleOutcomeRun(jobName, scope string, input run.InputData) *run.Run {
+	ask := CreateStep("ask_question")
+	ask.OnSuccess = CreateStep("say_hello")
+	ask.Outcomes = map[string]*run.Step{
+		"yes": CreateStep("say_goodbye1"),
+		"no":  CreateStep("say_goodbye2"),
+	}
+
+	j := run.NewJob(jobName, ask)
+	trig := run.Trigger{
+		JobName: jobName,
+		Scope:   scope,
+		Input:   input,
+	}
+
+	return run.NewRun(j, trig)
+}
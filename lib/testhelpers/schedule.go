@@ -0,0 +1,97 @@
+package testhelpers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mitchfriedman/workflow/lib/run"
+	"github.com/mitchfriedman/workflow/lib/schedule"
+)
+
+// MemoryScheduleRepo is an in-memory schedule.Repo for tests that don't need
+// a database. The runs of the schedules are created in rr.
+type MemoryScheduleRepo struct {
+	mu        sync.Mutex
+	schedules []*schedule.Schedule
+	leases    map[string]lease
+	rr        run.Creator
+}
+
+type lease struct {
+	holder  string
+	expires time.Time
+}
+
+func NewMemoryScheduleRepo(rr run.Creator) *MemoryScheduleRepo {
+	return &MemoryScheduleRepo{leases: make(map[string]lease), rr: rr}
+}
+
+func (m *MemoryScheduleRepo) CreateSchedule(ctx context.Context, s *schedule.Schedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s.Created = time.Now().UTC()
+	c := *s
+	m.schedules = append(m.schedules, &c)
+	return nil
+}
+
+func (m *MemoryScheduleRepo) DeleteSchedule(ctx context.Context, uuid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, s := range m.schedules {
+		if s.UUID == uuid {
+			m.schedules = append(m.schedules[:i], m.schedules[i+1:]...)
+			return nil
+		}
+	}
+	return schedule.ErrNotFound
+}
+
+func (m *MemoryScheduleRepo) ListSchedules(ctx context.Context) ([]*schedule.Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var all []*schedule.Schedule
+	for _, s := range m.schedules {
+		c := *s
+		all = append(all, &c)
+	}
+	return all, nil
+}
+
+func (m *MemoryScheduleRepo) Fire(ctx context.Context, s *schedule.Schedule, at time.Time, fired *run.Run) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.schedules {
+		if existing.UUID != s.UUID {
+			continue
+		}
+		if (existing.LastFired == nil) != (s.LastFired == nil) ||
+			(existing.LastFired != nil && !existing.LastFired.Equal(*s.LastFired)) {
+			return false, nil
+		}
+		if err := m.rr.CreateRun(ctx, fired); err != nil {
+			return false, err
+		}
+		existing.LastFired = &at
+		s.LastFired = &at
+		return true, nil
+	}
+	return false, schedule.ErrNotFound
+}
+
+func (m *MemoryScheduleRepo) AcquireLease(ctx context.Context, name, holder string, d time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	if l, ok := m.leases[name]; ok && l.holder != holder && l.expires.After(now) {
+		return false, nil
+	}
+	m.leases[name] = lease{holder: holder, expires: now.Add(d)}
+	return true, nil
+}
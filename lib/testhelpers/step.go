@@ -1,17 +1,20 @@
 package testhelpers
 
 import (
+	"context"
+
 	"github.com/mitchfriedman/workflow/lib/run"
 )
 
 type SampleStep struct {
-	Res run.Result
-	Err error
-	t   string
+	Res      run.Result
+	Err      error
+	Required []run.Input
+	t        string
 }
 
 func NewSampleStep(res run.Result, t string, err error) run.Stepper {
-	return &SampleStep{res, err, t}
+	return &SampleStep{Res: res, Err: err, t: t}
 }
 
 func (p *SampleStep) Type() string {
@@ -19,9 +22,37 @@ func (p *SampleStep) Type() string {
 }
 
 func (p *SampleStep) RequiredInput() []run.Input {
-	return []run.Input{}
+	if p.Required == nil {
+		return []run.Input{}
+	}
+	return p.Required
 }
 
 func (p *SampleStep) Step(d run.InputData) (run.Result, error) {
 	return p.Res, p.Err
 }
+
+// BlockingStep is a ContextStepper that blocks until its context is done. The
+// context of the last call is sent on Started before blocking.
+type BlockingStep struct {
+	Started chan context.Context
+	t       string
+}
+
+func NewBlockingStep(t string) *BlockingStep {
+	return &BlockingStep{Started: make(chan context.Context, 1), t: t}
+}
+
+func (p *BlockingStep) Type() string {
+	return p.t
+}
+
+func (p *BlockingStep) RequiredInput() []run.Input {
+	return []run.Input{}
+}
+
+func (p *BlockingStep) StepContext(ctx context.Context, d run.InputData) (run.Result, error) {
+	p.Started <- ctx
+	<-ctx.Done()
+	return run.Result{}, ctx.Err()
+}
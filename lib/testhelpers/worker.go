@@ -0,0 +1,69 @@
+package testhelpers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mitchfriedman/workflow/lib/worker"
+)
+
+// MemoryWorkerRepo is an in-memory worker.Repo for tests that don't need a
+// database.
+type MemoryWorkerRepo struct {
+	mu      sync.Mutex
+	workers map[string]worker.Worker
+}
+
+func NewMemoryWorkerRepo() *MemoryWorkerRepo {
+	return &MemoryWorkerRepo{workers: make(map[string]worker.Worker)}
+}
+
+func (m *MemoryWorkerRepo) RenewLease(ctx context.Context, w *worker.Worker, t time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.LastUpdated = time.Now().UTC()
+	w.LeaseClaimedUntil = time.Now().UTC().Add(t)
+	m.workers[w.UUID] = *w
+	return nil
+}
+
+func (m *MemoryWorkerRepo) Register(ctx context.Context, w *worker.Worker) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.workers[w.UUID] = *w
+	return nil
+}
+
+func (m *MemoryWorkerRepo) Deregister(ctx context.Context, workerId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.workers, workerId)
+	return nil
+}
+
+func (m *MemoryWorkerRepo) List(ctx context.Context) ([]*worker.Worker, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var all []*worker.Worker
+	for _, w := range m.workers {
+		w := w
+		all = append(all, &w)
+	}
+	return all, nil
+}
+
+func (m *MemoryWorkerRepo) Get(ctx context.Context, uuid string) (*worker.Worker, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, ok := m.workers[uuid]
+	if !ok {
+		return nil, nil
+	}
+	return &w, nil
+}
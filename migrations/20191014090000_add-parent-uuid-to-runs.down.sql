@@ -0,0 +1,3 @@
+drop index if exists index_runs_on_parent_uuid;
+
+alter table runs drop column parent_uuid;
@@ -0,0 +1,3 @@
+alter table runs add column parent_uuid varchar(64) default null;
+
+create index index_runs_on_parent_uuid on runs(parent_uuid);
@@ -0,0 +1 @@
+alter table runs add column version integer default 0 not null;
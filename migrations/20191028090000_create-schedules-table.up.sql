@@ -0,0 +1,24 @@
+create table schedules (
+    uuid varchar(64) not null
+        constraint schedules_pkey
+        primary key,
+
+    job_name varchar(128) not null,
+    scope varchar(128) not null,
+    cron varchar(128) not null,
+    data jsonb,
+
+    created timestamp default now_utc() not null,
+    last_fired timestamp default null
+);
+
+create index index_schedules_on_job_name on schedules(job_name);
+
+create table leases (
+    name varchar(64) not null
+        constraint leases_pkey
+        primary key,
+
+    holder varchar(64) not null,
+    expires timestamp not null
+);
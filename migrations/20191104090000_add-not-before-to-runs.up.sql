@@ -0,0 +1 @@
+alter table runs add column not_before timestamp default null;
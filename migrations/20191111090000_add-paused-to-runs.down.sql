@@ -0,0 +1 @@
+alter table runs drop column paused;
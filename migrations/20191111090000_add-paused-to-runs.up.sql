@@ -0,0 +1 @@
+alter table runs add column paused boolean default false not null;
@@ -0,0 +1,11 @@
+create table controls (
+    job_name varchar(128) default '' not null,
+    scope varchar(128) default '' not null,
+    reason text default '' not null,
+    paused_by varchar(128) default '' not null,
+    reject_triggers boolean default false not null,
+
+    created timestamp default now_utc() not null,
+
+    constraint controls_pkey primary key (job_name, scope)
+);